@@ -0,0 +1,405 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+func isTarArchive(name string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tarMaxLinks is how many links a path may go through, more is taken as a loop
+const tarMaxLinks = 40
+
+var errTarLinkLoop = errors.New("too many levels of symbolic links")
+
+// tarEntry is an archive member, or a dir only implied by member names
+type tarEntry struct {
+	header   *tar.Header
+	dataIdx  int      // index of the header the data follows, -1 if there is none
+	offset   int64    // of the data in the tar, -1 if it is not stored as is
+	children []string // sorted paths, for dirs
+}
+
+// tarFS lists a tar archive from its headers, data is read only when a file is opened.
+// A .tar.gz is decompressed once to a temporary .tar, so that any file can be read at
+// its offset: it takes as much disk space as the archive unpacked
+type tarFS struct {
+	file    *os.File // the .tar, the archive itself or its decompressed copy
+	entries map[string]*tarEntry
+}
+
+// decompressTar copies a .tar.gz to a temporary .tar, read from its start
+func decompressTar(file *os.File) (*os.File, error) {
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	tarFile, err := os.CreateTemp("", "dirTree-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(tarFile, gzipReader)
+	if err == nil {
+		_, err = tarFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tarFile.Close()
+		os.Remove(tarFile.Name())
+		return nil, err
+	}
+
+	return tarFile, nil
+}
+
+// isSparseTar tells entries whose data is not stored as is, tar.Reader has to expand it
+func isSparseTar(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// readTarFS reads the headers of a tar(.gz) archive, later members replace earlier ones
+// of the same path like they do on extraction. The returned func releases the archive
+func readTarFS(archivePath string) (*tarFS, func() error, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeFS := file.Close
+	if !strings.HasSuffix(archivePath, ".tar") {
+		tarFile, err := decompressTar(file)
+		file.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		file = tarFile
+		closeFS = func() error {
+			tarFile.Close()
+			return os.Remove(tarFile.Name())
+		}
+	}
+
+	fsys, err := readTarHeaders(file)
+	if err != nil {
+		closeFS()
+		return nil, nil, err
+	}
+	return fsys, closeFS, nil
+}
+
+func readTarHeaders(file *os.File) (*tarFS, error) {
+	fsys := &tarFS{
+		file: file,
+		entries: map[string]*tarEntry{
+			".": {header: &tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}, dataIdx: -1, offset: -1},
+		},
+	}
+	// tar.Reader reads file as is and seeks over data, the data of an entry
+	// starts where the file is after its header
+	tarReader := tar.NewReader(file)
+	hardLinks := make([]string, 0)
+	for headerIdx := 0; ; headerIdx++ {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if isSparseTar(header) {
+			offset = -1
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+		fsys.add(name, &tarEntry{header: header, dataIdx: headerIdx, offset: offset})
+		if header.Typeflag == tar.TypeLink {
+			hardLinks = append(hardLinks, name)
+		}
+	}
+
+	// a hard link is one more name of its target, with the same data
+	for _, name := range hardLinks {
+		entry := fsys.entries[name]
+		target, ok := fsys.entries[path.Clean(strings.TrimPrefix(entry.header.Linkname, "/"))]
+		if !ok || entry.header.Typeflag != tar.TypeLink || target.header.Typeflag != tar.TypeReg {
+			continue
+		}
+		linkHeader := *target.header
+		linkHeader.Name = entry.header.Name
+		entry.header, entry.dataIdx, entry.offset = &linkHeader, target.dataIdx, target.offset
+	}
+	for _, entry := range fsys.entries {
+		sort.Strings(entry.children)
+	}
+
+	return fsys, nil
+}
+
+// add puts an entry and the dirs it is in that have no header (yet)
+func (fsys *tarFS) add(name string, entry *tarEntry) {
+	if oldEntry, ok := fsys.entries[name]; ok {
+		entry.children = oldEntry.children
+		fsys.entries[name] = entry
+		return
+	}
+	fsys.entries[name] = entry
+
+	parentName := path.Dir(name)
+	if _, ok := fsys.entries[parentName]; !ok {
+		parentHeader := &tar.Header{Name: parentName + "/", Typeflag: tar.TypeDir, Mode: 0755}
+		fsys.add(parentName, &tarEntry{header: parentHeader, dataIdx: -1, offset: -1})
+	}
+	parent := fsys.entries[parentName]
+	parent.children = append(parent.children, name)
+}
+
+// resolve follows the links name goes through, the last element only if followLast.
+// Links may not lead out of the archive
+func (fsys *tarFS) resolve(op, name string, followLast bool) (*tarEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	resolved, elems := ".", splitTarPath(name)
+	for linkCount := 0; len(elems) > 0; {
+		elemPath := path.Join(resolved, elems[0])
+		elems = elems[1:]
+		entry, ok := fsys.entries[elemPath]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+
+		if entry.header.Typeflag == tar.TypeSymlink && (len(elems) > 0 || followLast) {
+			if linkCount++; linkCount > tarMaxLinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errTarLinkLoop}
+			}
+			targetPath := path.Join(resolved, entry.header.Linkname)
+			if path.IsAbs(entry.header.Linkname) || targetPath == ".." || strings.HasPrefix(targetPath, "../") {
+				return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			resolved, elems = ".", append(splitTarPath(targetPath), elems...)
+			continue
+		}
+		if len(elems) > 0 && !entry.header.FileInfo().IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		resolved = elemPath
+	}
+
+	return fsys.entries[resolved], nil
+}
+
+func splitTarPath(name string) []string {
+	if name == "." {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// Open reads files at their offset, dirs need no reading
+func (fsys *tarFS) Open(name string) (fs.File, error) {
+	entry, err := fsys.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info := entry.header.FileInfo()
+	noClose := func() error { return nil }
+	switch {
+	case info.IsDir():
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &tarDir{info: info, entries: entries}, nil
+	case entry.offset != -1:
+		return &tarFile{info: info, Reader: io.NewSectionReader(fsys.file, entry.offset, entry.header.Size), close: noClose}, nil
+	case entry.dataIdx == -1:
+		return &tarFile{info: info, Reader: strings.NewReader(""), close: noClose}, nil
+	}
+
+	// sparse data is expanded by tar.Reader, the headers before it are read again
+	tarReader := tar.NewReader(io.NewSectionReader(fsys.file, 0, math.MaxInt64))
+	for headerIdx := 0; headerIdx <= entry.dataIdx; headerIdx++ {
+		if _, err = tarReader.Next(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return &tarFile{info: info, Reader: tarReader, close: noClose}, nil
+}
+
+func (fsys *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := fsys.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.header.FileInfo().IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	dirEntries := make([]fs.DirEntry, 0, len(entry.children))
+	for _, childName := range entry.children {
+		dirEntries = append(dirEntries, fs.FileInfoToDirEntry(fsys.entries[childName].header.FileInfo()))
+	}
+	return dirEntries, nil
+}
+
+func (fsys *tarFS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := fsys.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return entry.header.FileInfo(), nil
+}
+
+func (fsys *tarFS) Lstat(name string) (fs.FileInfo, error) {
+	entry, err := fsys.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return entry.header.FileInfo(), nil
+}
+
+func (fsys *tarFS) ReadLink(name string) (string, error) {
+	entry, err := fsys.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if entry.header.Typeflag != tar.TypeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return entry.header.Linkname, nil
+}
+
+// tarFile reads the data of an entry straight from the archive
+type tarFile struct {
+	io.Reader
+	info  fs.FileInfo
+	close func() error
+}
+
+func (file *tarFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+func (file *tarFile) Close() error               { return file.close() }
+
+type tarDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (dir *tarDir) Stat() (fs.FileInfo, error) { return dir.info, nil }
+func (dir *tarDir) Close() error               { return nil }
+
+func (dir *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (dir *tarDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if count <= 0 || count >= len(dir.entries) {
+		entries := dir.entries
+		dir.entries = nil
+		if count > 0 && len(entries) == 0 {
+			return nil, io.EOF
+		}
+		return entries, nil
+	}
+
+	entries := dir.entries[:count]
+	dir.entries = dir.entries[count:]
+	return entries, nil
+}
+
+// zipFS adds links to zip.Reader, a zip link is an entry with the link mode and the target as data
+type zipFS struct {
+	*zip.ReadCloser
+}
+
+// Lstat is Stat, zip.Reader does not follow links
+func (fsys zipFS) Lstat(name string) (fs.FileInfo, error) {
+	return fs.Stat(fsys.ReadCloser, name)
+}
+
+func (fsys zipFS) ReadLink(name string) (string, error) {
+	info, err := fsys.Lstat(name)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+
+	target, err := fs.ReadFile(fsys.ReadCloser, name)
+	if err != nil {
+		return "", err
+	}
+	return string(target), nil
+}
+
+// sameFile is os.SameFile, which is false for anything not from os, or the same tar entry
+func sameFile(left, right os.FileInfo) bool {
+	if header, ok := left.Sys().(*tar.Header); ok {
+		return header == right.Sys()
+	}
+	return os.SameFile(left, right)
+}
+
+// openFS returns what to walk for rootPath: the dir itself or the contents of an archive
+func openFS(rootPath string) (fs.FS, func() error, error) {
+	noClose := func() error { return nil }
+
+	rootStat, err := os.Stat(rootPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rootStat.IsDir() {
+		return os.DirFS(rootPath), noClose, nil
+	}
+
+	switch {
+	case strings.HasSuffix(rootPath, ".zip"):
+		zipReader, err := zip.OpenReader(rootPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zipFS{zipReader}, zipReader.Close, nil
+	case isTarArchive(rootPath):
+		fsys, closeFS, err := readTarFS(rootPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return fsys, closeFS, nil
+	}
+
+	return nil, nil, fmt.Errorf("%s is neither a directory nor a supported archive", rootPath)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+
+	defaultLSColors = "di=01;34:ln=01;36:ex=01;32"
+)
+
+// lsColors maps LS_COLORS keys (di, ln, ex, *.ext) to SGR codes
+type lsColors map[string]string
+
+func parseLSColors(spec string) lsColors {
+	colors := make(lsColors)
+	for _, entry := range strings.Split(spec, ":") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		colors[parts[0]] = parts[1]
+	}
+
+	return colors
+}
+
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// resolveColors decides if the output is coloured, auto colours only terminals
+func resolveColors(opts *options) {
+	opts.colors = nil
+	switch opts.color {
+	case colorAlways:
+	case colorAuto:
+		if !isTerminal(os.Stdout) {
+			return
+		}
+	default:
+		return
+	}
+
+	spec := os.Getenv("LS_COLORS")
+	if spec == "" {
+		spec = defaultLSColors
+	}
+	opts.colors = parseLSColors(spec)
+}
+
+func (colors lsColors) code(node *Node) string {
+	switch {
+	case node.Target != "":
+		return colors["ln"]
+	case node.IsDir():
+		return colors["di"]
+	}
+
+	// executables are coloured as such whatever their extension, like ls does
+	if node.info != nil && node.info.Mode()&0111 != 0 && colors["ex"] != "" {
+		return colors["ex"]
+	}
+
+	// the longest matching extension wins, like "*.tar.gz" over "*.gz"
+	code, matchLen := "", 0
+	for key, keyCode := range colors {
+		if strings.HasPrefix(key, "*") && strings.HasSuffix(node.Name, key[1:]) && len(key) > matchLen {
+			code, matchLen = keyCode, len(key)
+		}
+	}
+	if code != "" {
+		return code
+	}
+	return colors["fi"]
+}
+
+func (colors lsColors) paint(node *Node) string {
+	if colors == nil {
+		return node.Name
+	}
+
+	code := colors.code(node)
+	if code == "" {
+		return node.Name
+	}
+	return "\033[" + code + "m" + node.Name + "\033[0m"
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strings"
+)
+
+const mtimeLayout = "2006-01-02 15:04"
+
+// columnSet holds metadata cells printed in brackets before entry names
+type columnSet struct {
+	cells      map[*Node][]string
+	widths     []int
+	rightAlign []bool
+	users      map[string]string
+	groups     map[string]string
+}
+
+func hasColumns(opts *options) bool {
+	return opts.perms || opts.owner || opts.group || opts.humanSizes || opts.mtime
+}
+
+func humanSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d", size)
+	}
+
+	value := float64(size)
+	unitIdx := -1
+	for value >= 1024 && unitIdx < len("KMGTP")-1 {
+		value /= 1024
+		unitIdx++
+	}
+	if value < 10 {
+		return fmt.Sprintf("%.1f%c", value, "KMGTP"[unitIdx])
+	}
+	return fmt.Sprintf("%.0f%c", value, "KMGTP"[unitIdx])
+}
+
+func lookupName(cache map[string]string, id string, lookup func(string) (string, error)) string {
+	if name, ok := cache[id]; ok {
+		return name
+	}
+
+	name, err := lookup(id)
+	if err != nil {
+		name = id
+	}
+	cache[id] = name
+
+	return name
+}
+
+func lookupUser(uid string) (string, error) {
+	owner, err := user.LookupId(uid)
+	if err != nil {
+		return "", err
+	}
+	return owner.Username, nil
+}
+
+func lookupGroup(gid string) (string, error) {
+	group, err := user.LookupGroupId(gid)
+	if err != nil {
+		return "", err
+	}
+	return group.Name, nil
+}
+
+func (cols *columnSet) nodeCells(node *Node, opts *options) []string {
+	cells := make([]string, 0, len(cols.widths))
+	// nodes loaded from a snapshot were not stat-ed
+	if node.info == nil {
+		for range cols.widths {
+			cells = append(cells, "?")
+		}
+		return cells
+	}
+
+	uid, gid, ok := getOwnerIDs(node.info)
+	if opts.perms {
+		cells = append(cells, node.info.Mode().String())
+	}
+	if opts.owner {
+		owner := "?"
+		if ok {
+			owner = lookupName(cols.users, uid, lookupUser)
+		}
+		cells = append(cells, owner)
+	}
+	if opts.group {
+		group := "?"
+		if ok {
+			group = lookupName(cols.groups, gid, lookupGroup)
+		}
+		cells = append(cells, group)
+	}
+	if opts.humanSizes {
+		size := node.Size
+		if node.IsDir() && !opts.du {
+			size = node.info.Size()
+		}
+		cells = append(cells, humanSize(size))
+	}
+	if opts.mtime {
+		cells = append(cells, node.info.ModTime().Format(mtimeLayout))
+	}
+
+	return cells
+}
+
+func (cols *columnSet) collect(nodes []*Node, opts *options) {
+	for _, node := range nodes {
+		cells := cols.nodeCells(node, opts)
+		for cellIdx, cell := range cells {
+			if width := len([]rune(cell)); width > cols.widths[cellIdx] {
+				cols.widths[cellIdx] = width
+			}
+		}
+		cols.cells[node] = cells
+
+		cols.collect(node.Children, opts)
+	}
+}
+
+// newColumnSet computes cells of the whole tree first, so that columns line up
+func newColumnSet(root *Node, opts *options) *columnSet {
+	if !hasColumns(opts) {
+		return nil
+	}
+
+	cols := &columnSet{
+		cells:  make(map[*Node][]string),
+		users:  make(map[string]string),
+		groups: make(map[string]string),
+	}
+	for _, enabled := range []bool{opts.perms, opts.owner, opts.group, opts.humanSizes, opts.mtime} {
+		if enabled {
+			cols.widths = append(cols.widths, 0)
+		}
+	}
+	// sizes are numbers and are aligned to the right
+	cols.rightAlign = make([]bool, len(cols.widths))
+	if opts.humanSizes {
+		sizeIdx := len(cols.widths) - 1
+		if opts.mtime {
+			sizeIdx--
+		}
+		cols.rightAlign[sizeIdx] = true
+	}
+	cols.collect(root.Children, opts)
+
+	return cols
+}
+
+func (cols *columnSet) format(node *Node) string {
+	if cols == nil {
+		return ""
+	}
+
+	padded := make([]string, 0, len(cols.widths))
+	for cellIdx, cell := range cols.cells[node] {
+		padding := strings.Repeat(" ", cols.widths[cellIdx]-len([]rune(cell)))
+		if cols.rightAlign[cellIdx] {
+			padded = append(padded, padding+cell)
+		} else {
+			padded = append(padded, cell+padding)
+		}
+	}
+
+	return "[" + strings.Join(padded, " ") + "]  "
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+const (
+	diffAdded   = "added"
+	diffRemoved = "removed"
+	diffChanged = "changed"
+)
+
+var diffMarkers = map[string]string{
+	diffAdded:   "[+] ",
+	diffRemoved: "[-] ",
+	diffChanged: "[~] ",
+}
+
+func markTree(node *Node, status string) {
+	node.Status = status
+	for _, child := range node.Children {
+		markTree(child, status)
+	}
+}
+
+func isNodeChanged(oldNode, newNode *Node) bool {
+	if oldNode.Type != newNode.Type || oldNode.Target != newNode.Target {
+		return true
+	}
+	// dirs are compared by their children
+	if newNode.IsDir() {
+		return false
+	}
+	if oldNode.Size != newNode.Size {
+		return true
+	}
+	// snapshots written without mtime can only be compared by size
+	if oldNode.ModTime.IsZero() || newNode.ModTime.IsZero() {
+		return false
+	}
+
+	return !oldNode.ModTime.Equal(newNode.ModTime)
+}
+
+// diffTrees merges oldNode into newNode marking what was added, removed or changed
+func diffTrees(oldNode, newNode *Node, opts *options) *Node {
+	if isNodeChanged(oldNode, newNode) {
+		newNode.Status = diffChanged
+		return newNode
+	}
+	// dirs cut by -L or loops were not read, nothing to compare
+	if !newNode.IsDir() || newNode.Children == nil {
+		return newNode
+	}
+
+	oldChildren := make(map[string]*Node, len(oldNode.Children))
+	for _, oldChild := range oldNode.Children {
+		oldChildren[oldChild.Name] = oldChild
+	}
+
+	merged := make([]*Node, 0, len(newNode.Children))
+	for _, newChild := range newNode.Children {
+		oldChild, ok := oldChildren[newChild.Name]
+		if !ok {
+			markTree(newChild, diffAdded)
+			merged = append(merged, newChild)
+			continue
+		}
+		delete(oldChildren, newChild.Name)
+		merged = append(merged, diffTrees(oldChild, newChild, opts))
+	}
+	for _, oldChild := range oldNode.Children {
+		if _, ok := oldChildren[oldChild.Name]; ok {
+			markTree(oldChild, diffRemoved)
+			merged = append(merged, oldChild)
+		}
+	}
+	sortNodes(merged, opts)
+	newNode.Children = merged
+
+	return newNode
+}
+
+// loadSnapshot reads a tree saved with -format=json
+func loadSnapshot(snapshotPath string) (*Node, error) {
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &Node{}
+	if err = json.Unmarshal(data, root); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+func runDiff(out io.Writer, args []string) error {
+	opts := &options{}
+	flags := newFlagSet(opts)
+	snapshotPath := flags.String("snapshot", "", "compare DIR against a tree saved with -format=json")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	render, err := checkOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	var oldRoot *Node
+	switch {
+	case *snapshotPath != "" && len(positional) == 1:
+		oldRoot, err = loadSnapshot(*snapshotPath)
+	case *snapshotPath == "" && len(positional) == 2:
+		oldRoot, err = buildPathTree(positional[0], opts)
+		positional = positional[1:]
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	newRoot, err := buildPathTree(positional[0], opts)
+	if err != nil {
+		return err
+	}
+
+	return renderRoot(out, diffTrees(oldRoot, newRoot, opts), render, opts)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// dupGroup is a set of files with identical content
+type dupGroup struct {
+	Size  int64
+	Paths []string
+}
+
+func (group dupGroup) wasted() int64 {
+	return group.Size * int64(len(group.Paths)-1)
+}
+
+// collectFiles groups file paths relative to the root by size
+func collectFiles(node *Node, nodePath string, bySize map[int64][]string) {
+	for _, child := range node.Children {
+		childPath := path.Join(nodePath, child.Name)
+		if child.Type == nodeFile {
+			bySize[child.Size] = append(bySize[child.Size], childPath)
+		}
+		collectFiles(child, childPath, bySize)
+	}
+}
+
+func hashFile(fsys fs.FS, filePath string) (string, error) {
+	file, err := fsys.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// findDuplicates hashes only files that share their size with another file
+func findDuplicates(fsys fs.FS, root *Node) ([]dupGroup, error) {
+	bySize := make(map[int64][]string)
+	collectFiles(root, "", bySize)
+
+	groups := make([]dupGroup, 0)
+	for size, paths := range bySize {
+		// empty files are all equal and waste nothing
+		if size == 0 || len(paths) < 2 {
+			continue
+		}
+
+		byHash := make(map[string][]string)
+		for _, filePath := range paths {
+			hash, err := hashFile(fsys, filePath)
+			if err != nil {
+				return nil, err
+			}
+			byHash[hash] = append(byHash[hash], filePath)
+		}
+
+		for _, samePaths := range byHash {
+			if len(samePaths) > 1 {
+				sort.Strings(samePaths)
+				groups = append(groups, dupGroup{Size: size, Paths: samePaths})
+			}
+		}
+	}
+
+	sort.Slice(groups, func(leftIdx, rightIdx int) bool {
+		left, right := groups[leftIdx], groups[rightIdx]
+		if left.wasted() != right.wasted() {
+			return left.wasted() > right.wasted()
+		}
+		return left.Paths[0] < right.Paths[0]
+	})
+
+	return groups, nil
+}
+
+func renderDuplicates(out io.Writer, rootPath string, opts *options) error {
+	// duplicates are searched among all files, shown or not
+	dupsOpts := *opts
+	dupsOpts.printFiles = true
+	fsys, closeFS, err := openFS(rootPath)
+	if err != nil {
+		return err
+	}
+	defer closeFS()
+
+	root, err := buildTree(fsys, filepath.Base(rootPath), &dupsOpts)
+	if err != nil {
+		return err
+	}
+
+	groups, err := findDuplicates(fsys, root)
+	if err != nil {
+		return err
+	}
+
+	var totalWasted int64
+	for _, group := range groups {
+		fmt.Fprintf(out, "%db x %d, %db wasted\n", group.Size, len(group.Paths), group.wasted())
+		for _, filePath := range group.Paths {
+			fmt.Fprintf(out, "\t%s\n", filePath)
+		}
+		totalWasted += group.wasted()
+	}
+	fmt.Fprintf(out, "%d duplicate groups, %db wasted\n", len(groups), totalWasted)
+
+	return errors.Join(collectErrors(root, nil)...)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const gitignoreName = ".gitignore"
+
+// patternList is a repeatable glob flag
+type patternList []string
+
+func (patterns *patternList) String() string {
+	return strings.Join(*patterns, ",")
+}
+
+// Set ...
+func (patterns *patternList) Set(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return err
+	}
+	*patterns = append(*patterns, pattern)
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ignoreRule is a single line of a .gitignore file
+type ignoreRule struct {
+	base     string // dir of the .gitignore relative to the tree root
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func parseIgnoreRule(base string, line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.pattern = line
+
+	return rule, true
+}
+
+func readIgnoreRules(fsys fs.FS, base string) ([]ignoreRule, error) {
+	file, err := fsys.Open(path.Join(base, gitignoreName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := make([]ignoreRule, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(base, scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, scanner.Err()
+}
+
+// matchSegments matches slash separated globs, "**" matches any number of segments
+func matchSegments(patternParts []string, nameParts []string) bool {
+	if len(patternParts) == 0 {
+		return len(nameParts) == 0
+	}
+
+	if patternParts[0] == "**" {
+		for skip := 0; skip <= len(nameParts); skip++ {
+			if matchSegments(patternParts[1:], nameParts[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(nameParts) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(patternParts[0], nameParts[0]); !matched {
+		return false
+	}
+
+	return matchSegments(patternParts[1:], nameParts[1:])
+}
+
+func (rule ignoreRule) match(relPath string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+
+	if rule.base != "" {
+		if !strings.HasPrefix(relPath, rule.base+"/") {
+			return false
+		}
+		relPath = relPath[len(rule.base)+1:]
+	}
+
+	if !rule.anchored {
+		matched, _ := path.Match(rule.pattern, path.Base(relPath))
+		return matched
+	}
+
+	return matchSegments(strings.Split(rule.pattern, "/"), strings.Split(relPath, "/"))
+}
+
+// isIgnored applies rules in order, the last matching rule wins
+func isIgnored(rules []ignoreRule, relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.match(relPath, isDir) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+func filterFiles(objsInfo []os.FileInfo, keepLinks bool) []os.FileInfo {
+	tmpObjsInfo := make([]os.FileInfo, 0)
+	for _, objInfo := range objsInfo {
+		if objInfo.IsDir() || keepLinks && objInfo.Mode()&os.ModeSymlink != 0 {
+			tmpObjsInfo = append(tmpObjsInfo, objInfo)
+		}
+	}
+
+	return tmpObjsInfo
+}
+
+func filterEntries(objsInfo []os.FileInfo, relPath string, rules []ignoreRule, opts *options) []os.FileInfo {
+	// du and loc count hidden files too
+	if !opts.printFiles && !opts.fullWalk() {
+		objsInfo = filterFiles(objsInfo, opts.followLinks)
+	}
+
+	tmpObjsInfo := make([]os.FileInfo, 0, len(objsInfo))
+	for _, objInfo := range objsInfo {
+		name := objInfo.Name()
+		if matchAny(opts.excludes, name) {
+			continue
+		}
+		if !objInfo.IsDir() && len(opts.includes) > 0 && !matchAny(opts.includes, name) {
+			continue
+		}
+		if opts.gitignore {
+			if objInfo.IsDir() && name == ".git" {
+				continue
+			}
+			if isIgnored(rules, path.Join(relPath, name), objInfo.IsDir()) {
+				continue
+			}
+		}
+		tmpObjsInfo = append(tmpObjsInfo, objInfo)
+	}
+
+	return tmpObjsInfo
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const formatHTML = "html"
+
+var htmlTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: monospace; }
+ul { list-style: none; margin: 0; padding-left: 1.5em; }
+summary { cursor: pointer; }
+.info { color: #888; }
+.added { color: #080; }
+.removed { color: #a00; text-decoration: line-through; }
+.changed { color: #a60; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{template "children" .}}
+</body>
+</html>
+{{define "children"}}<ul>
+{{range .Children}}{{template "node" .}}{{end}}</ul>
+{{end}}
+{{define "node"}}<li{{with .Status}} class="{{.}}"{{end}}>{{if .IsDir}}<details open><summary><a href="{{.Href}}">{{.Name}}</a>{{if .Info}} <span class="info">{{.Info}}</span>{{end}}</summary>
+{{template "children" .}}</details>{{else}}<a href="{{.Href}}">{{.Name}}</a>{{if .Info}} <span class="info">{{.Info}}</span>{{end}}{{end}}</li>
+{{end}}`))
+
+// htmlNode is a Node with everything the template needs already computed
+type htmlNode struct {
+	Name     string
+	Href     string
+	Info     string
+	Status   string
+	IsDir    bool
+	Children []htmlNode
+}
+
+func getNodeInfo(node *Node, opts *options) string {
+	info := ""
+	switch {
+	case node.Target != "":
+		info = "-> " + node.Target
+	case !node.IsDir():
+		info = "(" + formatBytes(node.Size, opts) + ")"
+	case node.Entries > 0:
+		info = getCollapsed(node, opts)
+	case opts.du:
+		info = fmt.Sprintf("(%s, %s)", formatBytes(node.Size, opts), plural(node.Files, "file", "files"))
+	}
+	if node.Loop {
+		info += " [recursive, not followed]"
+	}
+	if node.Err != "" {
+		info += " [error: " + node.Err + "]"
+	}
+	if node.More > 0 {
+		info += fmt.Sprintf(" [%d more not shown]", node.More)
+	}
+
+	return strings.TrimSpace(info)
+}
+
+// getHref links entries relative to the -H base href
+func getHref(nodePath string, isDir bool, opts *options) string {
+	segments := strings.Split(nodePath, "/")
+	for segmentIdx, segment := range segments {
+		segments[segmentIdx] = url.PathEscape(segment)
+	}
+
+	href := strings.Join(segments, "/")
+	if opts.htmlBase != "" {
+		href = strings.TrimRight(opts.htmlBase, "/") + "/" + href
+	}
+	if isDir {
+		href += "/"
+	}
+
+	return href
+}
+
+func newHTMLNode(node *Node, nodePath string, opts *options) htmlNode {
+	view := htmlNode{
+		Name:   node.Name,
+		Href:   getHref(nodePath, node.IsDir(), opts),
+		Info:   getNodeInfo(node, opts),
+		Status: node.Status,
+		IsDir:  node.IsDir(),
+	}
+	for _, child := range node.Children {
+		view.Children = append(view.Children, newHTMLNode(child, path.Join(nodePath, child.Name), opts))
+	}
+
+	return view
+}
+
+func renderHTML(out io.Writer, root *Node, opts *options) error {
+	view := newHTMLNode(root, "", opts)
+	return htmlTemplate.Execute(out, view)
+}
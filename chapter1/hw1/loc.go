@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+const textLanguage = "Text"
+
+// language describes the comment syntax of files with the given extensions
+type language struct {
+	name         string
+	lineComments []string
+	blockStart   string
+	blockEnd     string
+}
+
+var languages = map[string]language{}
+
+func init() {
+	for _, lang := range []struct {
+		language
+		exts []string
+	}{
+		{language{"Go", []string{"//"}, "/*", "*/"}, []string{".go"}},
+		{language{"C", []string{"//"}, "/*", "*/"}, []string{".c", ".h"}},
+		{language{"C++", []string{"//"}, "/*", "*/"}, []string{".cpp", ".cc", ".hpp"}},
+		{language{"Java", []string{"//"}, "/*", "*/"}, []string{".java"}},
+		{language{"JavaScript", []string{"//"}, "/*", "*/"}, []string{".js"}},
+		{language{"TypeScript", []string{"//"}, "/*", "*/"}, []string{".ts"}},
+		{language{"Protobuf", []string{"//"}, "/*", "*/"}, []string{".proto"}},
+		{language{"CSS", nil, "/*", "*/"}, []string{".css"}},
+		{language{"HTML", nil, "<!--", "-->"}, []string{".html", ".htm"}},
+		{language{"XML", nil, "<!--", "-->"}, []string{".xml"}},
+		{language{"Python", []string{"#"}, "", ""}, []string{".py"}},
+		{language{"Shell", []string{"#"}, "", ""}, []string{".sh"}},
+		{language{"Ruby", []string{"#"}, "", ""}, []string{".rb"}},
+		{language{"YAML", []string{"#"}, "", ""}, []string{".yml", ".yaml"}},
+		{language{"SQL", []string{"--"}, "/*", "*/"}, []string{".sql"}},
+		{language{"Markdown", nil, "", ""}, []string{".md"}},
+	} {
+		for _, ext := range lang.exts {
+			languages[ext] = lang.language
+		}
+	}
+}
+
+// LineCount ...
+type LineCount struct {
+	Language string `json:"language,omitempty" xml:"language,attr,omitempty"`
+	Lines    int    `json:"lines" xml:"lines,attr"`
+	Blank    int    `json:"blank" xml:"blank,attr"`
+	Comment  int    `json:"comment" xml:"comment,attr"`
+}
+
+func (count *LineCount) add(other *LineCount) {
+	count.Lines += other.Lines
+	count.Blank += other.Blank
+	count.Comment += other.Comment
+}
+
+func (count *LineCount) String() string {
+	return fmt.Sprintf("%s, %d blank, %d comment", plural(count.Lines, "line", "lines"), count.Blank, count.Comment)
+}
+
+func hasPrefixAny(line string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// locBinaryCheckSize is how much of a file is looked at for a NUL byte, like git does
+const locBinaryCheckSize = 8000
+
+// locHeadSize is how much of a line is kept to look for comment prefixes
+const locHeadSize = 256
+
+// locLine is what countLines needs to know of a line, whatever its length
+type locLine struct {
+	head          string // first bytes after leading spaces
+	blank         bool
+	end           bool // has the block comment end
+	endAfterStart bool // has the block comment end past a block comment start opening the line
+}
+
+// readLocLine reads a line chunk by chunk, so that long lines take no more memory than short ones
+func readLocLine(reader *bufio.Reader, lang language) (*locLine, error) {
+	line := &locLine{blank: true}
+	head := make([]byte, 0, locHeadSize)
+	carry := ""     // tail of the previous chunk, the block end may be split between chunks
+	contentLen := 0 // bytes after leading spaces read before this chunk
+	read := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			read = true
+		}
+		if err == nil {
+			chunk = chunk[:len(chunk)-1]
+		}
+		if line.blank {
+			chunk = bytes.TrimLeft(chunk, " \t\r\v\f")
+			line.blank = len(chunk) == 0
+		}
+
+		if len(chunk) > 0 {
+			head = append(head, chunk[:min(len(chunk), locHeadSize-len(head))]...)
+			if lang.blockEnd != "" {
+				window := carry + string(chunk)
+				for searchIdx := 0; ; {
+					foundIdx := strings.Index(window[searchIdx:], lang.blockEnd)
+					if foundIdx == -1 {
+						break
+					}
+					line.end = true
+					if contentLen-len(carry)+searchIdx+foundIdx >= len(lang.blockStart) {
+						line.endAfterStart = true
+					}
+					searchIdx += foundIdx + 1
+				}
+				carry = window[max(0, len(window)-len(lang.blockEnd)+1):]
+			}
+			contentLen += len(chunk)
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && !read:
+			return nil, io.EOF
+		case err != nil && err != io.EOF:
+			return nil, err
+		}
+		line.head = string(head)
+		return line, nil
+	}
+}
+
+// countLines reads a file, binary files and unknown binary formats get nil
+func countLines(fsys fs.FS, name string) (*LineCount, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, locBinaryCheckSize)
+	head, err := reader.Peek(locBinaryCheckSize)
+	if err != nil && err != io.EOF {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	if bytes.IndexByte(head, 0) != -1 {
+		return nil, nil
+	}
+
+	lang, ok := languages[path.Ext(name)]
+	if !ok {
+		lang = language{name: textLanguage}
+	}
+
+	count := &LineCount{Language: lang.name}
+	inBlock := false
+	for {
+		line, err := readLocLine(reader, lang)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+		}
+		count.Lines++
+
+		switch {
+		case inBlock:
+			count.Comment++
+			inBlock = !line.end
+		case line.blank:
+			count.Blank++
+		case hasPrefixAny(line.head, lang.lineComments):
+			count.Comment++
+		case lang.blockStart != "" && strings.HasPrefix(line.head, lang.blockStart):
+			count.Comment++
+			inBlock = !line.endAfterStart
+		}
+	}
+
+	return count, nil
+}
+
+// sumLines rolls up line counts of already summed children
+func sumLines(node *Node) {
+	node.Loc = &LineCount{}
+	for _, child := range node.Children {
+		if child.Loc != nil {
+			node.Loc.add(child.Loc)
+		}
+	}
+}
@@ -1,115 +1,222 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
-	"strings"
+	"time"
 )
 
-func calcIndent(path string, isPrevIndent string, isPrevLast bool) string {
-	indent := ""
-	sepsNumber := strings.Count(path, string(os.PathSeparator))
-	if sepsNumber < 2 {
-		return indent
-	}
+type options struct {
+	printFiles  bool
+	format      string
+	includes    patternList
+	excludes    patternList
+	gitignore   bool
+	prune       bool
+	maxDepth    int
+	du          bool
+	followLinks bool
+	sortBy      string
+	reverse     bool
+	dirsFirst   bool
+	jobs        int
+	keepGoing   bool
+	dups        bool
+	humanSizes  bool
+	perms       bool
+	owner       bool
+	group       bool
+	mtime       bool
+	htmlBase    string
+	watch       bool
+	interval    time.Duration
+	report      bool
+	stats       bool
+	charset     string
+	indent      int
+	color       string
+	loc         bool
+	fileLimit   int
+	head        int
+
+	glyphs glyphs   // computed by renderText
+	colors lsColors // computed from color and LS_COLORS, nil is no colours
+}
 
-	if isPrevLast {
-		indent = isPrevIndent + "\t"
-	} else {
-		indent = isPrevIndent + "│\t"
-	}
+// fullWalk is true when dir totals need files and dirs hidden by -f and -L
+func (opts *options) fullWalk() bool {
+	return opts.du || opts.loc
+}
 
-	return indent
+func newFlagSet(opts *options) *flag.FlagSet {
+	flags := flag.NewFlagSet("dirTree", flag.ContinueOnError)
+	flags.BoolVar(&opts.printFiles, "f", false, "print files")
+	flags.StringVar(&opts.format, "format", formatText, "output format: text|json|xml|ndjson|html|svg")
+	flags.Var(&opts.includes, "P", "list only files matching the glob, repeatable")
+	flags.Var(&opts.excludes, "I", "do not list entries matching the glob, repeatable")
+	flags.BoolVar(&opts.gitignore, "gitignore", false, "honour .gitignore files found while walking")
+	flags.BoolVar(&opts.prune, "prune", false, "hide directories left empty after filtering")
+	flags.IntVar(&opts.maxDepth, "L", 0, "max display depth, 0 is unlimited")
+	flags.BoolVar(&opts.du, "du", false, "print cumulative size and file count of directories")
+	flags.BoolVar(&opts.followLinks, "l", false, "follow symbolic links to directories")
+	flags.StringVar(&opts.sortBy, "sort", sortName, "sort entries by name|version|size|mtime, size and mtime put largest and newest first")
+	flags.BoolVar(&opts.reverse, "r", false, "reverse the sort order")
+	flags.BoolVar(&opts.dirsFirst, "dirsfirst", false, "list directories before files")
+	flags.IntVar(&opts.jobs, "j", 1, "number of directories read in parallel")
+	flags.BoolVar(&opts.keepGoing, "k", false, "keep going on errors, failed entries are annotated")
+	flags.BoolVar(&opts.dups, "dups", false, "report groups of files with identical content instead of the tree")
+	flags.BoolVar(&opts.humanSizes, "h", false, "print human readable sizes in a column")
+	flags.BoolVar(&opts.perms, "p", false, "print permissions")
+	flags.BoolVar(&opts.owner, "u", false, "print file owner")
+	flags.BoolVar(&opts.group, "g", false, "print file group")
+	flags.BoolVar(&opts.mtime, "D", false, "print modification time")
+	flags.StringVar(&opts.htmlBase, "H", "", "render html, links are relative to the base href")
+	flags.BoolVar(&opts.watch, "watch", false, "poll for changes and re-render the tree marking what changed")
+	flags.DurationVar(&opts.interval, "interval", 2*time.Second, "poll interval of -watch")
+	flags.BoolVar(&opts.report, "report", true, "print directory, file and byte totals after a text tree")
+	flags.BoolVar(&opts.stats, "stats", false, "add file count and bytes by extension to the totals")
+	flags.StringVar(&opts.charset, "charset", charsetUnicode, "tree lines charset: unicode|ascii")
+	flags.IntVar(&opts.indent, "indent", 0, "indent width in spaces, 0 keeps the tab layout")
+	flags.BoolVar(&opts.loc, "loc", false, "count total, blank and comment lines of text files, with totals per directory")
+	flags.IntVar(&opts.fileLimit, "filelimit", 0, "do not expand directories with more than N entries, 0 is unlimited")
+	flags.IntVar(&opts.head, "head", 0, "list only the first N entries of each directory, 0 is unlimited")
+	flags.StringVar(&opts.color, "color", colorAuto, "colour entries with LS_COLORS: auto|always|never, auto colours terminals only")
+
+	return flags
 }
 
-func filterFiles(objsInfo []os.FileInfo) []os.FileInfo {
-	tmpObjsInfo := make([]os.FileInfo, 0)
-	for _, objInfo := range objsInfo {
-		if objInfo.IsDir() {
-			tmpObjsInfo = append(tmpObjsInfo, objInfo)
+// parseFlags allows flags to go before and after positional arguments
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			break
 		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
 	}
 
-	return tmpObjsInfo
+	return positional, nil
 }
 
-func getObjName(path string) string {
-	separatorLastIndex := strings.LastIndex(path, string(os.PathSeparator))
-	if separatorLastIndex == -1 {
-		return ""
+func checkOptions(opts *options) (renderer, error) {
+	if opts.htmlBase != "" {
+		opts.format = formatHTML
+	}
+	render, ok := renderers[opts.format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", opts.format)
+	}
+	// treemap areas are du sizes
+	if opts.format == formatSVG {
+		opts.du = true
+	}
+	if err := checkSortBy(opts.sortBy); err != nil {
+		return nil, err
+	}
+	if opts.charset != "" && opts.charset != charsetUnicode && opts.charset != charsetASCII {
+		return nil, fmt.Errorf("unknown charset %q", opts.charset)
 	}
+	if opts.color != "" && opts.color != colorAuto && opts.color != colorAlways && opts.color != colorNever {
+		return nil, fmt.Errorf("unknown color %q", opts.color)
+	}
+	resolveColors(opts)
 
-	return path[strings.LastIndex(path, string(os.PathSeparator))+1:]
+	return render, nil
 }
 
-func getFileSize(fileInfo os.FileInfo) string {
-	if fileInfo.Size() == 0 {
-		return " (empty)"
+// renderRoot renders a built tree and reports errors kept by -k
+func renderRoot(out io.Writer, root *Node, render renderer, opts *options) error {
+	if err := render(out, root, opts); err != nil {
+		return err
 	}
 
-	return fmt.Sprintf(" (%db)", fileInfo.Size())
+	return errors.Join(collectErrors(root, nil)...)
 }
 
-func printTree(out *bytes.Buffer, path string, prevIndent string, printFiles bool, isLast bool, isPrevLast bool) error {
-	objStat, err := os.Stat(path)
+func renderTree(out io.Writer, path string, opts *options) error {
+	render, err := checkOptions(opts)
 	if err != nil {
 		return err
 	}
+	if opts.dups {
+		return renderDuplicates(out, path, opts)
+	}
 
-	currIndent := calcIndent(path, prevIndent, isPrevLast)
-	prevIndent = currIndent
-	if isLast {
-		currIndent += "└───"
-	} else {
-		currIndent += "├───"
+	root, err := buildPathTree(path, opts)
+	if err != nil {
+		return err
 	}
 
-	if !objStat.IsDir() {
-		if printFiles {
-			out.WriteString(currIndent + getObjName(path) + getFileSize(objStat) + "\n")
-		}
-	} else {
-		if dirName := getObjName(path); dirName != "" {
-			out.WriteString(currIndent + dirName + "\n")
-		}
+	return renderRoot(out, root, render, opts)
+}
 
-		innerObjs, err := ioutil.ReadDir(path)
-		if err != nil {
-			return err
-		}
-		if !printFiles {
-			innerObjs = filterFiles(innerObjs)
-		}
+func dirTree(out *bytes.Buffer, path string, printFiles bool) error {
+	return renderTree(out, path, &options{printFiles: printFiles, format: formatText})
+}
 
-		isCurrLast := false
-		for innerObjIdx, innerObj := range innerObjs {
-			if innerObjIdx == len(innerObjs)-1 {
-				isCurrLast = true
-			}
-			printTree(out, path+"/"+innerObj.Name(), prevIndent, printFiles, isCurrLast, isLast)
-		}
-	}
+type command func(out io.Writer, args []string) error
 
-	return nil
+var commands = map[string]command{
+	"diff":     runDiff,
+	"serve":    runServe,
+	"scaffold": runScaffold,
+	"manifest": runManifest,
+	"verify":   runVerify,
 }
 
-func dirTree(out *bytes.Buffer, path string, printFiles bool) error {
-	printTree(out, path, "", printFiles, false, false)
-	return nil
+var errUsage = errors.New(`usage:
+	dirTree [flags] DIR
+	dirTree diff [flags] OLD_DIR NEW_DIR
+	dirTree diff [flags] -snapshot tree.json DIR
+	dirTree serve [flags] [-addr :8080] DIR
+	dirTree scaffold [-n] [-links] SPEC|- DIR
+	dirTree manifest [-j N] DIR
+	dirTree verify [-j N] MANIFEST DIR`)
+
+func runTree(out io.Writer, args []string) error {
+	opts := &options{}
+	positional, err := parseFlags(newFlagSet(opts), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+	if opts.watch {
+		if opts.interval <= 0 {
+			return fmt.Errorf("bad interval %s, it has to be positive", opts.interval)
+		}
+		return watchTree(out, os.Stderr, positional[0], opts, time.NewTicker(opts.interval).C)
+	}
+
+	return renderTree(out, positional[0], opts)
 }
 
 func main() {
-	out := new(bytes.Buffer)
-	if !(len(os.Args) == 2 || len(os.Args) == 3) {
-		panic("usage go run main.go . [-f]")
+	run, args := runTree, os.Args[1:]
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			run, args = cmd, args[1:]
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	err := run(out, args)
+	out.Flush()
+	if err == flag.ErrHelp {
+		return
 	}
-	path := os.Args[1]
-	printFiles := len(os.Args) == 3 && os.Args[2] == "-f"
-	err := dirTree(out, path, printFiles)
 	if err != nil {
-		panic(err.Error())
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	fmt.Println(out)
 }
@@ -1,8 +1,28 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 const testFullResult = `├───project
@@ -73,3 +93,1359 @@ func TestTreeDir(t *testing.T) {
 		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDirResult)
 	}
 }
+
+func renderTestTree(t *testing.T, path string, opts *options) string {
+	out := new(bytes.Buffer)
+	err := renderTree(out, path, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return out.String()
+}
+
+const testNDJSONResult = `{"path":"empty.txt","name":"empty.txt","type":"file","size":0}
+{"path":"lorem","name":"lorem","type":"dir","size":0}
+{"path":"lorem/dolor.txt","name":"dolor.txt","type":"file","size":0}
+{"path":"lorem/gopher.png","name":"gopher.png","type":"file","size":70372}
+{"path":"lorem/ipsum","name":"ipsum","type":"dir","size":0}
+{"path":"lorem/ipsum/gopher.png","name":"gopher.png","type":"file","size":70372}
+`
+
+func TestTreeNDJSON(t *testing.T) {
+	result := renderTestTree(t, "testdata/zline", &options{printFiles: true, format: formatNDJSON})
+	if result != testNDJSONResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testNDJSONResult)
+	}
+}
+
+const testXMLResult = `<?xml version="1.0" encoding="UTF-8"?>
+<node name="zline" type="dir" size="0">
+	<node name="empty.txt" type="file" size="0"></node>
+	<node name="lorem" type="dir" size="0">
+		<node name="dolor.txt" type="file" size="0"></node>
+		<node name="gopher.png" type="file" size="70372"></node>
+		<node name="ipsum" type="dir" size="0">
+			<node name="gopher.png" type="file" size="70372"></node>
+		</node>
+	</node>
+</node>
+`
+
+func TestTreeXML(t *testing.T) {
+	result := renderTestTree(t, "testdata/zline", &options{printFiles: true, format: formatXML})
+	if result != testXMLResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testXMLResult)
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	result := renderTestTree(t, "testdata", &options{printFiles: true, format: formatJSON})
+
+	root := &Node{}
+	if err := json.Unmarshal([]byte(result), root); err != nil {
+		t.Fatalf("cant decode json: %v", err)
+	}
+
+	// json and text must describe the same tree
+	out := new(bytes.Buffer)
+	renderText(out, root, &options{})
+	if out.String() != testFullResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), testFullResult)
+	}
+}
+
+const testFilterResult = `├───project
+│	└───gopher.png (70372b)
+└───static
+	└───a_lorem
+		├───gopher.png (70372b)
+		└───ipsum
+			└───gopher.png (70372b)
+`
+
+func TestTreeFilter(t *testing.T) {
+	opts := &options{printFiles: true, format: formatText, prune: true}
+	opts.includes.Set("*.png")
+	opts.excludes.Set("z*")
+	result := renderTestTree(t, "testdata", opts)
+	if result != testFilterResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testFilterResult)
+	}
+}
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		filePath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+const testGitignoreResult = `├───.gitignore (27b)
+├───main.go (empty)
+└───src
+	├───.gitignore (9b)
+	├───keep.log (empty)
+	└───lib
+		└───lib.go (empty)
+`
+
+func TestTreeGitignore(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		".gitignore":                    "*.log\nnode_modules/\n/build\n",
+		"main.go":                       "",
+		"build/out.bin":                 "",
+		"node_modules/pkg/index.js":     "",
+		"src/.gitignore":                "!keep.log",
+		"src/keep.log":                  "",
+		"src/drop.log":                  "",
+		"src/lib/lib.go":                "",
+		"src/lib/node_modules/index.js": "",
+	})
+
+	result := renderTestTree(t, root, &options{printFiles: true, format: formatText, gitignore: true})
+	if result != testGitignoreResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testGitignoreResult)
+	}
+}
+
+const testDuResult = `├───project (70391b, 2 files)
+├───static (281583b, 10 files)
+│	├───a_lorem (140744b, 3 files)
+│	├───css (28b, 1 file)
+│	├───html (57b, 1 file)
+│	├───js (10b, 1 file)
+│	└───z_lorem (140744b, 3 files)
+└───zline (140744b, 4 files)
+	└───lorem (140744b, 3 files)
+`
+
+func TestTreeDu(t *testing.T) {
+	result := renderTestTree(t, "testdata", &options{format: formatText, du: true, maxDepth: 2})
+	if result != testDuResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDuResult)
+	}
+}
+
+const testDepthResult = `├───project
+│	├───file.txt (19b)
+│	└───gopher.png (70372b)
+├───static
+│	├───a_lorem
+│	├───css
+│	├───empty.txt (empty)
+│	├───html
+│	├───js
+│	└───z_lorem
+├───zline
+│	├───empty.txt (empty)
+│	└───lorem
+└───zzfile.txt (empty)
+`
+
+func TestTreeDepth(t *testing.T) {
+	result := renderTestTree(t, "testdata", &options{printFiles: true, format: formatText, maxDepth: 2})
+	if result != testDepthResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDepthResult)
+	}
+}
+
+const testLinksResult = `├───a
+│	├───b
+│	│	├───loop -> ../.. [recursive, not followed]
+│	│	└───up -> .. [recursive, not followed]
+│	└───file.txt -> ../file.txt
+├───broken -> nowhere
+├───c -> a/b
+│	├───loop -> ../.. [recursive, not followed]
+│	└───up -> ..
+│		├───b [recursive, not followed]
+│		└───file.txt -> ../file.txt
+└───file.txt (empty)
+`
+
+func TestTreeLinks(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"file.txt": ""})
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"broken":     "nowhere",
+		"c":          "a/b",
+		"a/file.txt": "../file.txt",
+		"a/b/loop":   "../..",
+		"a/b/up":     "..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+
+	result := renderTestTree(t, root, &options{printFiles: true, format: formatText, followLinks: true})
+	if result != testLinksResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testLinksResult)
+	}
+}
+
+func TestCompareVersion(t *testing.T) {
+	testCases := []struct {
+		Left, Right string
+		Less        bool
+	}{
+		{"file2.txt", "file10.txt", true},
+		{"file10.txt", "file2.txt", false},
+		{"v1.9.2", "v1.10.0", true},
+		{"a007", "a8", true},
+		{"abc", "abd", true},
+		{"img", "img1", true},
+	}
+
+	for _, testCase := range testCases {
+		if less := compareVersion(testCase.Left, testCase.Right) < 0; less != testCase.Less {
+			t.Errorf("compareVersion(%q, %q) < 0 = %v, expected %v", testCase.Left, testCase.Right, less, testCase.Less)
+		}
+	}
+}
+
+const testSortResult = `├───a_lorem (140744b, 3 files)
+│	├───ipsum (70372b, 1 file)
+│	│	└───gopher.png (70372b)
+│	├───gopher.png (70372b)
+│	└───dolor.txt (empty)
+├───z_lorem (140744b, 3 files)
+│	├───ipsum (70372b, 1 file)
+│	│	└───gopher.png (70372b)
+│	├───gopher.png (70372b)
+│	└───dolor.txt (empty)
+├───html (57b, 1 file)
+│	└───index.html (57b)
+├───css (28b, 1 file)
+│	└───body.css (28b)
+├───js (10b, 1 file)
+│	└───site.js (10b)
+└───empty.txt (empty)
+`
+
+func TestTreeSort(t *testing.T) {
+	opts := &options{printFiles: true, format: formatText, du: true, sortBy: sortSize, dirsFirst: true}
+	result := renderTestTree(t, "testdata/static", opts)
+	if result != testSortResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testSortResult)
+	}
+
+	// structured output keeps the same order
+	opts.format = formatJSON
+	root := &Node{}
+	if err := json.Unmarshal([]byte(renderTestTree(t, "testdata/static", opts)), root); err != nil {
+		t.Fatalf("cant decode json: %v", err)
+	}
+	out := new(bytes.Buffer)
+	renderText(out, root, opts)
+	if out.String() != testSortResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), testSortResult)
+	}
+}
+
+func TestTreeParallel(t *testing.T) {
+	for _, format := range []string{formatText, formatJSON, formatXML, formatNDJSON} {
+		sequential := renderTestTree(t, "testdata", &options{printFiles: true, format: format, du: true})
+		parallel := renderTestTree(t, "testdata", &options{printFiles: true, format: format, du: true, jobs: 4})
+		if parallel != sequential {
+			t.Errorf("%s results not match\nGot:\n%v\nExpected:\n%v", format, parallel, sequential)
+		}
+	}
+}
+
+// goroutineFS records how many goroutines run while dirs are read
+type goroutineFS struct {
+	fstest.MapFS
+	maxGoroutines atomic.Int64
+}
+
+func (fsys *goroutineFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	count := int64(runtime.NumGoroutine())
+	for maxCount := fsys.maxGoroutines.Load(); count > maxCount && !fsys.maxGoroutines.CompareAndSwap(maxCount, count); {
+		maxCount = fsys.maxGoroutines.Load()
+	}
+	return fsys.MapFS.ReadDir(name)
+}
+
+func TestTreeParallelLarge(t *testing.T) {
+	// 8 + 64 + 512 dirs with a file each
+	fsys := &goroutineFS{MapFS: fstest.MapFS{}}
+	var addDirs func(dirPath string, depth int)
+	addDirs = func(dirPath string, depth int) {
+		for dirIdx := 0; dirIdx < 8; dirIdx++ {
+			subPath := path.Join(dirPath, fmt.Sprintf("d%d", dirIdx))
+			fsys.MapFS[subPath+"/file.txt"] = &fstest.MapFile{Data: []byte(subPath)}
+			if depth < 3 {
+				addDirs(subPath, depth+1)
+			}
+		}
+	}
+	addDirs(".", 1)
+
+	render := func(opts *options) string {
+		root, err := buildTree(fsys, "root", opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out := new(bytes.Buffer)
+		renderText(out, root, opts)
+		return out.String()
+	}
+	sequential := render(&options{printFiles: true, du: true, report: true})
+
+	baseGoroutines := int64(runtime.NumGoroutine())
+	fsys.maxGoroutines.Store(0)
+	parallel := render(&options{printFiles: true, du: true, report: true, jobs: 4})
+	if parallel != sequential {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", parallel, sequential)
+	}
+	if maxGoroutines := fsys.maxGoroutines.Load(); maxGoroutines > baseGoroutines+4 {
+		t.Errorf("%d goroutines for -j 4, expected at most %d", maxGoroutines, baseGoroutines+4)
+	}
+}
+
+const testKeepGoingResult = `├───bad [error: is a directory]
+└───good
+	└───file.txt (empty)
+`
+
+func TestTreeKeepGoing(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"good/file.txt": ""})
+	// a .gitignore that is a directory fails to read even for root, unlike chmod
+	if err := os.MkdirAll(filepath.Join(root, "bad", ".gitignore"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	err := renderTree(out, root, &options{printFiles: true, format: formatText, gitignore: true})
+	if err == nil || out.Len() != 0 {
+		t.Errorf("expected error without output, got %v and %q", err, out.String())
+	}
+
+	out.Reset()
+	err = renderTree(out, root, &options{printFiles: true, format: formatText, gitignore: true, keepGoing: true})
+	if err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Errorf("expected aggregated error, got %v", err)
+	}
+	if out.String() != testKeepGoingResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), testKeepGoingResult)
+	}
+}
+
+func touchTestFiles(t *testing.T, root string, modTime time.Time) {
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, modTime, modTime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+const testDiffResult = `├───[-] gone
+│	└───[-] file.txt (empty)
+├───[+] new.txt (3b)
+├───same
+│	├───[~] resized.txt (6b)
+│	├───same.txt (4b)
+│	└───[~] touched.txt (4b)
+└───[~] turned (empty)
+`
+
+func TestTreeDiff(t *testing.T) {
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldRoot, newRoot := t.TempDir(), t.TempDir()
+	writeTestFiles(t, oldRoot, map[string]string{
+		"gone/file.txt":    "",
+		"same/resized.txt": "old",
+		"same/same.txt":    "same",
+		"same/touched.txt": "same",
+		"turned/file.txt":  "",
+	})
+	writeTestFiles(t, newRoot, map[string]string{
+		"new.txt":          "new",
+		"same/resized.txt": "resize",
+		"same/same.txt":    "same",
+		"same/touched.txt": "same",
+		"turned":           "",
+	})
+	touchTestFiles(t, oldRoot, modTime)
+	touchTestFiles(t, newRoot, modTime)
+	touched := filepath.Join(newRoot, "same", "touched.txt")
+	os.Chtimes(touched, modTime, modTime.Add(time.Hour))
+
+	out := new(bytes.Buffer)
+	err := runDiff(out, []string{"-f", "-report=false", oldRoot, newRoot})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != testDiffResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), testDiffResult)
+	}
+
+	// the same through a json snapshot of the old dir
+	snapshotPath := filepath.Join(t.TempDir(), "tree.json")
+	snapshot, err := os.Create(snapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = renderTree(snapshot, oldRoot, &options{printFiles: true, format: formatJSON})
+	snapshot.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	err = runDiff(out, []string{"-f", "-report=false", "-snapshot", snapshotPath, newRoot})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != testDiffResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), testDiffResult)
+	}
+}
+
+const testDupsResult = `70372b x 7, 422232b wasted
+	project/gopher.png
+	static/a_lorem/gopher.png
+	static/a_lorem/ipsum/gopher.png
+	static/z_lorem/gopher.png
+	static/z_lorem/ipsum/gopher.png
+	zline/lorem/gopher.png
+	zline/lorem/ipsum/gopher.png
+1 duplicate groups, 422232b wasted
+`
+
+func TestTreeDups(t *testing.T) {
+	result := renderTestTree(t, "testdata", &options{format: formatText, dups: true})
+	if result != testDupsResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testDupsResult)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte("aaaa")},
+		"b/a.txt":   {Data: []byte("aaaa")},
+		"b/c.txt":   {Data: []byte("cccc")},
+		"d/e/c.txt": {Data: []byte("cccc")},
+		"d/f.txt":   {Data: []byte("ffff")},
+		"x/y.txt":   {Data: []byte("aaaa")},
+	}
+
+	tree, err := buildTree(fsys, "root", &options{printFiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := findDuplicates(fsys, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []dupGroup{
+		{Size: 4, Paths: []string{"a.txt", "b/a.txt", "x/y.txt"}},
+		{Size: 4, Paths: []string{"b/c.txt", "d/e/c.txt"}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", groups, expected)
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	testCases := map[int64]string{
+		0:                  "0",
+		1023:               "1023",
+		1024:               "1.0K",
+		70372:              "69K",
+		5 * 1024 * 1024:    "5.0M",
+		3 << 40:            "3.0T",
+		1536 * 1024 * 1024: "1.5G",
+	}
+
+	for size, expected := range testCases {
+		if result := humanSize(size); result != expected {
+			t.Errorf("humanSize(%d) = %q, expected %q", size, result, expected)
+		}
+	}
+}
+
+const testColumnsResult = `├───[drwxr-x--- 69K]  big (1 file)
+│	└───[-rw------- 69K]  gopher.png
+└───[-rwxr-xr-x   7]  run.sh
+`
+
+func TestTreeColumns(t *testing.T) {
+	root := t.TempDir()
+	gopher, err := os.ReadFile("testdata/project/gopher.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, root, map[string]string{
+		"big/gopher.png": string(gopher),
+		"run.sh":         "#!/bin/",
+	})
+	os.Chmod(filepath.Join(root, "big"), 0750)
+	os.Chmod(filepath.Join(root, "big", "gopher.png"), 0600)
+	os.Chmod(filepath.Join(root, "run.sh"), 0755)
+
+	result := renderTestTree(t, root, &options{printFiles: true, format: formatText, du: true, humanSizes: true, perms: true})
+	if result != testColumnsResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testColumnsResult)
+	}
+}
+
+const testArchiveResult = `├───docs
+│	└───readme.md (6b)
+└───main.go (12b)
+`
+
+var testArchiveFiles = map[string]string{
+	"docs/readme.md": "readme",
+	"main.go":        "package main",
+}
+
+func writeTestZip(t *testing.T, archivePath string) {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	zipWriter := zip.NewWriter(file)
+	for name, content := range testArchiveFiles {
+		entry, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write([]byte(content))
+	}
+	if err = zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTarGz(t *testing.T, archivePath string) {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	tarWriter.WriteHeader(&tar.Header{Name: "docs/", Typeflag: tar.TypeDir, Mode: 0755})
+	for name, content := range testArchiveFiles {
+		tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		tarWriter.Write([]byte(content))
+	}
+	if err = tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTreeArchive(t *testing.T) {
+	root := t.TempDir()
+	zipPath, tarPath := filepath.Join(root, "build.zip"), filepath.Join(root, "build.tar.gz")
+	writeTestZip(t, zipPath)
+	writeTestTarGz(t, tarPath)
+
+	for _, archivePath := range []string{zipPath, tarPath} {
+		result := renderTestTree(t, archivePath, &options{printFiles: true, format: formatText})
+		if result != testArchiveResult {
+			t.Errorf("%s results not match\nGot:\n%v\nExpected:\n%v", archivePath, result, testArchiveResult)
+		}
+	}
+}
+
+const testArchiveLinksResult = `├───a
+│	├───f.txt (6b)
+│	├───hard.txt (6b)
+│	└───up -> .. [recursive, not followed]
+└───b
+	├───l -> sub
+	│	└───x.go (10b)
+	└───sub
+		└───x.go (10b)
+`
+
+const testZipLinkResult = `└───src
+	├───a.txt (3b)
+	└───l -> a.txt
+`
+
+func TestTreeArchiveLinks(t *testing.T) {
+	root := t.TempDir()
+	tarPath, zipPath := filepath.Join(root, "links.tar"), filepath.Join(root, "links.zip")
+
+	tarFile, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarWriter := tar.NewWriter(tarFile)
+	for _, member := range []struct {
+		header *tar.Header
+		data   string
+	}{
+		{&tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{&tar.Header{Name: "a/f.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 6}, "hello\n"},
+		{&tar.Header{Name: "a/hard.txt", Typeflag: tar.TypeLink, Linkname: "a/f.txt"}, ""},
+		{&tar.Header{Name: "a/up", Typeflag: tar.TypeSymlink, Linkname: ".."}, ""},
+		{&tar.Header{Name: "b/sub/x.go", Typeflag: tar.TypeReg, Mode: 0644, Size: 10}, "package x\n"},
+		{&tar.Header{Name: "b/l", Typeflag: tar.TypeSymlink, Linkname: "sub"}, ""},
+	} {
+		tarWriter.WriteHeader(member.header)
+		tarWriter.Write([]byte(member.data))
+	}
+	if err = tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tarFile.Close()
+
+	result := renderTestTree(t, tarPath, &options{printFiles: true, format: formatText, followLinks: true})
+	if result != testArchiveLinksResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testArchiveLinksResult)
+	}
+
+	// data of hard links is read from their target
+	fsys, closeFS, err := readTarFS(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFS()
+	data, err := fs.ReadFile(fsys, "a/hard.txt")
+	if err != nil || string(data) != "hello\n" {
+		t.Errorf("results not match\nGot:\n%q %v\nExpected:\n%q", data, err, "hello\n")
+	}
+
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(zipFile)
+	entry, _ := zipWriter.Create("src/a.txt")
+	entry.Write([]byte("aaa"))
+	linkHeader := &zip.FileHeader{Name: "src/l"}
+	linkHeader.SetMode(fs.ModeSymlink | 0777)
+	entry, _ = zipWriter.CreateHeader(linkHeader)
+	entry.Write([]byte("a.txt"))
+	if err = zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipFile.Close()
+
+	result = renderTestTree(t, zipPath, &options{printFiles: true, format: formatText, followLinks: true})
+	if result != testZipLinkResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testZipLinkResult)
+	}
+}
+
+func TestTarGzFiles(t *testing.T) {
+	tarPath := filepath.Join(t.TempDir(), "build.tar.gz")
+	writeTestTarGz(t, tarPath)
+
+	fsys, closeFS, err := readTarFS(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// files are read at their offset in the decompressed copy, in any order
+	for _, name := range []string{"main.go", "docs/readme.md", "main.go"} {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil || string(data) != testArchiveFiles[name] {
+			t.Errorf("results not match\nGot:\n%q %v\nExpected:\n%q", data, err, testArchiveFiles[name])
+		}
+	}
+
+	if err = closeFS(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(fsys.file.Name()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("decompressed copy is left behind: %v", err)
+	}
+}
+
+func TestTreeMapFS(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for name, content := range testArchiveFiles {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	root, err := buildTree(fsys, "root", &options{printFiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	renderText(out, root, &options{})
+	if out.String() != testArchiveResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), testArchiveResult)
+	}
+}
+
+func TestTreeHTML(t *testing.T) {
+	result := renderTestTree(t, "testdata/zline", &options{printFiles: true, htmlBase: "/files"})
+
+	expected := []string{
+		"<title>zline</title>",
+		`<li><a href="/files/empty.txt">empty.txt</a> <span class="info">(0b)</span></li>`,
+		`<li><details open><summary><a href="/files/lorem/">lorem</a></summary>`,
+		`<li><a href="/files/lorem/ipsum/gopher.png">gopher.png</a> <span class="info">(70372b)</span></li>`,
+	}
+	for _, part := range expected {
+		if !strings.Contains(result, part) {
+			t.Errorf("html does not contain %q\nGot:\n%v", part, result)
+		}
+	}
+	if strings.Count(result, "<details") != strings.Count(result, "</details>") || strings.Count(result, "<details") != 2 {
+		t.Errorf("expected 2 collapsible dirs\nGot:\n%v", result)
+	}
+}
+
+const testWatchResult = `└───a.txt (empty)
+
+--- 12:00:00 ---
+├───[~] a.txt (3b)
+└───[+] b.txt (empty)
+
+--- 12:00:02 ---
+├───a.txt (3b)
+└───[-] b.txt (empty)
+`
+
+func TestTreeWatch(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"a.txt": ""})
+
+	out := new(bytes.Buffer)
+	watcher, err := newTreeWatcher(out, io.Discard, root, &options{printFiles: true, format: formatText})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tick := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	writeTestFiles(t, root, map[string]string{"a.txt": "abc", "b.txt": ""})
+	// nothing changes between the first and the second poll, nothing is printed
+	for _, delay := range []time.Duration{0, time.Second} {
+		if err = watcher.poll(out, tick.Add(delay)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Remove(filepath.Join(root, "b.txt"))
+	if err = watcher.poll(out, tick.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != testWatchResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), testWatchResult)
+	}
+}
+
+func TestTreeWatchKeepGoing(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"good/file.txt": ""})
+	if err := os.MkdirAll(filepath.Join(root, "bad", ".gitignore"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// errors kept by -k are reported on every render, the watch goes on
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	watcher, err := newTreeWatcher(out, errOut, root, &options{printFiles: true, format: formatText, gitignore: true, keepGoing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, root, map[string]string{"good/new.txt": ""})
+	if err = watcher.poll(out, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(errOut.String(), "is a directory") != 2 {
+		t.Errorf("expected the error reported twice, got %q", errOut.String())
+	}
+
+	// a failed walk is reported, the next poll sees the tree again
+	errOut.Reset()
+	if err = os.Rename(root, root+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err = watcher.poll(out, time.Now()); err != nil || !strings.Contains(errOut.String(), "no such file") {
+		t.Errorf("expected the walk error reported, got %v %q", err, errOut.String())
+	}
+	if err = os.Rename(root+".moved", root); err != nil {
+		t.Fatal(err)
+	}
+	if err = watcher.poll(out, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	err = runTree(io.Discard, []string{"-watch", "-interval=0", root})
+	if err == nil || !strings.Contains(err.Error(), "bad interval") {
+		t.Errorf("expected bad interval error, got %v", err)
+	}
+}
+
+const testStatsResult = testFullResult + `
+12 directories, 17 files, 492718b
+.png	7 files	492604b
+.html	1 file	57b
+.css	1 file	28b
+.txt	7 files	19b
+.js	1 file	10b
+`
+
+// goneFS lists entries that are removed before their info is read
+type goneFS struct {
+	fstest.MapFS
+	gone string
+}
+
+type goneEntry struct {
+	fs.DirEntry
+}
+
+func (entry goneEntry) Info() (fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "lstat", Path: entry.Name(), Err: fs.ErrNotExist}
+}
+
+func (fsys goneFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fsys.MapFS.ReadDir(name)
+	for entryIdx, entry := range entries {
+		if entry.Name() == fsys.gone {
+			entries[entryIdx] = goneEntry{entry}
+		}
+	}
+	return entries, err
+}
+
+func TestTreeGoneEntry(t *testing.T) {
+	fsys := goneFS{MapFS: fstest.MapFS{"a.txt": {}, "b.txt": {}}, gone: "a.txt"}
+	root, err := buildTree(fsys, "root", &options{printFiles: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(root.Children) != 1 || root.Children[0].Name != "b.txt" {
+		t.Errorf("expected only b.txt, got %v", root.Children)
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	result := renderTestTree(t, "testdata", &options{printFiles: true, format: formatText, report: true, stats: true})
+	if result != testStatsResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testStatsResult)
+	}
+}
+
+const testCharsetResult = "|-- empty.txt (empty)\n" +
+	"`-- lorem\n" +
+	"    |-- dolor.txt (empty)\n" +
+	"    |-- gopher.png (70372b)\n" +
+	"    `-- ipsum\n" +
+	"        `-- gopher.png (70372b)\n"
+
+func TestTreeCharset(t *testing.T) {
+	result := renderTestTree(t, "testdata/zline", &options{printFiles: true, format: formatText, charset: charsetASCII, indent: 4})
+	if result != testCharsetResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testCharsetResult)
+	}
+}
+
+const testColorResult = "├───\033[01;34mdir\033[0m\n" +
+	"│\t└───\033[35mimage.png\033[0m (1b)\n" +
+	"├───\033[32mrun.sh\033[0m (1b)\n" +
+	"└───text.txt (1b)\n"
+
+func TestTreeColor(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"dir/image.png": "x", "run.sh": "x", "text.txt": "x"})
+	os.Chmod(filepath.Join(root, "run.sh"), 0755)
+	// ex wins over the extension of executables
+	t.Setenv("LS_COLORS", "di=01;34:ex=32:*.png=35:*.sh=33")
+
+	result := renderTestTree(t, root, &options{printFiles: true, format: formatText, color: colorAlways})
+	if result != testColorResult {
+		t.Errorf("results not match\nGot:\n%q\nExpected:\n%q", result, testColorResult)
+	}
+
+	if _, err := checkOptions(&options{format: formatText, color: "bogus"}); err == nil {
+		t.Errorf("expected an unknown color error")
+	}
+}
+
+func TestTreeHandler(t *testing.T) {
+	handler := NewTreeHandler(os.DirFS("testdata"), "testdata", &options{printFiles: true})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	testCases := []struct {
+		Query    string
+		Status   int
+		Children []string
+	}{
+		{"", http.StatusOK, []string{"project", "static", "zline", "zzfile.txt"}},
+		{"path=static/a_lorem&depth=1", http.StatusOK, []string{"dolor.txt", "gopher.png", "ipsum"}},
+		{"path=/static/a_lorem/&depth=2", http.StatusOK, []string{"dolor.txt", "gopher.png", "ipsum", "gopher.png"}},
+		{"path=../", http.StatusBadRequest, nil},
+		{"path=static/../../etc", http.StatusBadRequest, nil},
+		{"path=nope", http.StatusNotFound, nil},
+		{"depth=0", http.StatusBadRequest, nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Query, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "/tree?" + testCase.Query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != testCase.Status {
+				t.Fatalf("status %d, expected %d", resp.StatusCode, testCase.Status)
+			}
+			if testCase.Status != http.StatusOK {
+				return
+			}
+
+			result := struct{ Response *Node }{}
+			if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0)
+			var collect func(node *Node)
+			collect = func(node *Node) {
+				for _, child := range node.Children {
+					names = append(names, child.Name)
+					collect(child)
+				}
+			}
+			collect(result.Response)
+			if !reflect.DeepEqual(names, testCase.Children) {
+				t.Errorf("children %v, expected %v", names, testCase.Children)
+			}
+		})
+	}
+}
+
+// readDirFS records the dirs read through it
+type readDirFS struct {
+	fstest.MapFS
+	readDirs []string
+}
+
+func (fsys *readDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys.readDirs = append(fsys.readDirs, name)
+	return fsys.MapFS.ReadDir(name)
+}
+
+func TestTreeHandlerDepth(t *testing.T) {
+	fsys := &readDirFS{MapFS: fstest.MapFS{"a/b/c/d.txt": {Data: []byte("d")}}}
+	handler := NewTreeHandler(fsys, "root", &options{printFiles: true, du: true, loc: true})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/tree?depth=1", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, expected %d", recorder.Code, http.StatusOK)
+	}
+	if expected := []string{"."}; !reflect.DeepEqual(fsys.readDirs, expected) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fsys.readDirs, expected)
+	}
+
+	for _, flag := range []string{"-du", "-loc", "-format=svg"} {
+		if err := runServe(io.Discard, []string{flag, "testdata"}); err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Errorf("%s: expected not supported error, got %v", flag, err)
+		}
+	}
+}
+
+const testLocResult = `├───bin.dat (4b)
+├───main.go (59b) [8 lines, 1 blank, 4 comment]
+└───scripts [4 lines, 1 blank, 1 comment]
+	└───run.py (28b) [4 lines, 1 blank, 1 comment]
+
+1 directory, 3 files, 91b
+Go	8 lines, 1 blank, 4 comment
+Python	4 lines, 1 blank, 1 comment
+`
+
+func TestTreeLoc(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"bin.dat":        "a\x00b\n",
+		"main.go":        "// Package main\npackage main\n\n/*\n block\n*/\nfunc main() {\n}\n",
+		"scripts/run.py": "# run\nimport os\n\nos.exit(0)\n",
+	})
+
+	result := renderTestTree(t, root, &options{printFiles: true, format: formatText, loc: true, report: true})
+	if result != testLocResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testLocResult)
+	}
+}
+
+func TestCountLinesLong(t *testing.T) {
+	fsys := fstest.MapFS{
+		// the block end is split between the chunks of bufio.Reader
+		"main.go": {Data: []byte("/*" + strings.Repeat("x", locBinaryCheckSize-3) + "*/\n" +
+			"var s = \"" + strings.Repeat("y", 2*1024*1024) + "\"\n\n" +
+			strings.Repeat(" ", 5000) + "// comment\n")},
+	}
+
+	result, err := countLines(fsys, "main.go")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &LineCount{Language: "Go", Lines: 4, Blank: 1, Comment: 2}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestCountLinesBinary(t *testing.T) {
+	fsys := fstest.MapFS{
+		// past the default 4096 bytes of bufio.Reader
+		"late.txt":  {Data: []byte(strings.Repeat("x\n", 3000) + "\x00")},
+		"after.txt": {Data: []byte(strings.Repeat("x\n", locBinaryCheckSize/2) + "\x00")},
+	}
+
+	result, err := countLines(fsys, "late.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != nil {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, nil)
+	}
+
+	// only the head of the file is checked
+	result, err = countLines(fsys, "after.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &LineCount{Language: "Text", Lines: locBinaryCheckSize/2 + 1}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+const testLimitResult = `├───big [3 entries, 6b]
+├───small
+│	└───a.txt (1b)
+└───… and 3 more
+
+2 directories, 1 file, 7b (and 3 files, 6b more)
+`
+
+const testLimitDuResult = `├───big [3 entries, 7b]
+├───small (1b, 1 file)
+│	└───a.txt (1b)
+└───… and 3 more
+
+2 directories, 1 file, 8b (and 3 files, 6b more)
+`
+
+const testLimitHumanResult = `├───[7]  big [3 entries, 7B]
+├───[1]  small (1 file)
+│	└───[1]  a.txt
+└───… and 3 more
+
+2 directories, 1 file, 8B (and 3 files, 6B more)
+`
+
+const testLimitNestedResult = `├───big
+│	├───sub
+│	│	└───c.go (1b)
+│	└───… and 2 more
+└───… and 4 more
+
+2 directories, 1 file, 1b (and 1 directory, 6 files, 13b more)
+`
+
+func TestTreeLimit(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"a.txt":        "a",
+		"b.txt":        "bb",
+		"c.txt":        "ccc",
+		"big/a.txt":    "a",
+		"big/b.txt":    "bbbbb",
+		"big/sub/c.go": "c",
+		"small/a.txt":  "a",
+	})
+
+	result := renderTestTree(t, root, &options{printFiles: true, format: formatText, fileLimit: 2, head: 2, dirsFirst: true, report: true})
+	if result != testLimitResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testLimitResult)
+	}
+
+	result = renderTestTree(t, root, &options{printFiles: true, format: formatText, fileLimit: 2, head: 2, dirsFirst: true, du: true, report: true})
+	if result != testLimitDuResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testLimitDuResult)
+	}
+
+	// sizes outside the column keep their unit
+	result = renderTestTree(t, root, &options{printFiles: true, format: formatText, fileLimit: 2, head: 2, dirsFirst: true, du: true, humanSizes: true, report: true})
+	if result != testLimitHumanResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testLimitHumanResult)
+	}
+
+	// entries cut at every level are in the footer
+	result = renderTestTree(t, root, &options{printFiles: true, format: formatText, head: 1, dirsFirst: true, report: true})
+	if result != testLimitNestedResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testLimitNestedResult)
+	}
+}
+
+const testScaffoldSpec = `├───[+] cmd
+│   └───main.go (120b) [12 lines, 1 blank, 2 comment]
+├───docs [3 entries, 10b]
+├───empty.txt (empty)
+├───lib (12b, 1 file)
+│   └───... and 1 more
+├───link -> cmd/main.go
+└───src
+    ├───a.go (empty)
+    └───b
+        └───c.go (empty)
+
+4 directories, 5 files, 120b
+`
+
+const testScaffoldResult = `mkdir cmd
+create cmd/main.go
+mkdir docs
+create empty.txt
+mkdir lib
+link link -> cmd/main.go
+mkdir src
+create src/a.go
+mkdir src/b
+create src/b/c.go
+`
+
+func TestScaffold(t *testing.T) {
+	root := t.TempDir()
+	// -indent 4 layout and the original tab one
+	tabSpec := strings.ReplaceAll(strings.ReplaceAll(testScaffoldSpec, "│   ", "│\t"), "    ", "\t")
+	for specIdx, spec := range []string{testScaffoldSpec, tabSpec} {
+		specRoot, err := parseSpec([]byte(spec))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out := new(bytes.Buffer)
+		if err = scaffoldDir(out, specRoot, root, specIdx == 0, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if out.String() != testScaffoldResult {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), testScaffoldResult)
+		}
+	}
+
+	// scaffolding what dirTree prints gives the same tree back
+	result := renderTestTree(t, root, &options{printFiles: true, format: formatText})
+	specRoot, err := parseSpec([]byte(result))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	copyRoot := t.TempDir()
+	if err = scaffoldDir(io.Discard, specRoot, copyRoot, false, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if copyResult := renderTestTree(t, copyRoot, &options{printFiles: true, format: formatText}); copyResult != result {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", copyResult, result)
+	}
+
+	// metadata columns, with -p telling the types
+	columnsResult := renderTestTree(t, root, &options{printFiles: true, format: formatText, perms: true, humanSizes: true})
+	if specRoot, err = parseSpec([]byte(columnsResult)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	columnsRoot := t.TempDir()
+	if err = scaffoldDir(io.Discard, specRoot, columnsRoot, false, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if copyResult := renderTestTree(t, columnsRoot, &options{printFiles: true, format: formatText}); copyResult != result {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", copyResult, result)
+	}
+	columnsResult = renderTestTree(t, root, &options{printFiles: true, format: formatText, humanSizes: true})
+	if _, err = parseSpec([]byte(columnsResult)); !errors.Is(err, errBadSpecColumns) {
+		t.Errorf("expected errBadSpecColumns, got %v", err)
+	}
+
+	specRoot, err = parseSpec([]byte(`{"name": "x", "children": [{"name": "..", "type": "dir"}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = scaffoldDir(io.Discard, specRoot, copyRoot, false, true); !errors.Is(err, errBadSpecName) {
+		t.Errorf("expected errBadSpecName, got %v", err)
+	}
+
+	// a link followed by a dir of the same name, a link with entries, a dir over an existing
+	// link, links out of the target dir, a file with entries
+	outside := t.TempDir()
+	if err = os.Symlink(outside, filepath.Join(copyRoot, "existing")); err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range []string{
+		`{"children": [{"name": "x", "type": "link", "target": "existing"}, {"name": "x", "type": "dir", "children": [{"name": "pwned.txt", "type": "file"}]}]}`,
+		`{"children": [{"name": "x", "type": "link", "target": "existing", "children": [{"name": "pwned.txt", "type": "file"}]}]}`,
+		`{"children": [{"name": "existing", "type": "dir", "children": [{"name": "pwned.txt", "type": "file"}]}]}`,
+		`{"children": [{"name": "x", "type": "link", "target": "` + outside + `"}]}`,
+		`{"children": [{"name": "a", "type": "dir", "children": [{"name": "x", "type": "link", "target": "../.."}]}]}`,
+		`{"children": [{"name": "a.txt", "type": "file"}, {"name": "b.txt", "type": "file", "children": [{"name": "c.txt", "type": "file"}]}]}`,
+	} {
+		specRoot, err = parseSpec([]byte(spec))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err = scaffoldDir(io.Discard, specRoot, copyRoot, false, true); !errors.Is(err, errBadSpecTree) {
+			t.Errorf("expected errBadSpecTree, got %v", err)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("scaffold wrote outside of the target dir: %v", entries)
+	}
+	if _, err = os.Lstat(filepath.Join(copyRoot, "a.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("scaffold created entries of a bad spec: %v", err)
+	}
+
+	// links are created only with -links
+	specRoot, err = parseSpec([]byte(testScaffoldSpec))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := new(bytes.Buffer)
+	if err = scaffoldDir(out, specRoot, copyRoot, true, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := strings.Replace(testScaffoldResult, "link link", "skip link link", 1)
+	if out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+}
+
+func TestScaffoldDashNames(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"-dash": "abc", "--": "", "-dir/─x": "", "-dir/y": ""})
+
+	for _, opts := range []*options{
+		{printFiles: true, format: formatText},
+		{printFiles: true, format: formatText, charset: charsetASCII},
+		{printFiles: true, format: formatText, indent: 4},
+		{printFiles: true, format: formatText, charset: charsetASCII, indent: 4},
+	} {
+		result := renderTestTree(t, root, opts)
+		specRoot, err := parseSpec([]byte(result))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		copyRoot := t.TempDir()
+		if err = scaffoldDir(io.Discard, specRoot, copyRoot, false, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if copyResult := renderTestTree(t, copyRoot, opts); copyResult != strings.Replace(result, "(3b)", "(empty)", 1) {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", copyResult, result)
+		}
+	}
+}
+
+const testVerifyResult = `missing b.txt
+extra c.txt
+modified sub/d.txt
+`
+
+func TestManifest(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"a.txt":     "a",
+		"b.txt":     "b",
+		"sub/d.txt": "d",
+	})
+
+	out := new(bytes.Buffer)
+	if err := runManifest(out, []string{root}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	manifest := out.String()
+	expected, err := readManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(expected) != 3 || expected["sub/d.txt"].Size != 1 {
+		t.Errorf("unexpected manifest:\n%v", manifest)
+	}
+
+	// flags that would leave files out are not accepted
+	if err = runManifest(io.Discard, []string{"-head", "1", root}); err == nil {
+		t.Errorf("expected an error for -head")
+	}
+	out.Reset()
+	if err = runManifest(out, []string{"-j", "4", root}); err != nil || out.String() != manifest {
+		t.Errorf("results not match %v\nGot:\n%v\nExpected:\n%v", err, out.String(), manifest)
+	}
+
+	entries, err := buildManifest(root, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out.Reset()
+	if err = verifyManifest(out, expected, entries); err != nil || out.String() != "3 files ok\n" {
+		t.Errorf("unexpected verify result %v:\n%v", err, out.String())
+	}
+
+	os.Remove(filepath.Join(root, "b.txt"))
+	writeTestFiles(t, root, map[string]string{
+		"c.txt":     "c",
+		"sub/d.txt": "D",
+	})
+	entries, err = buildManifest(root, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out.Reset()
+	if err = verifyManifest(out, expected, entries); !errors.Is(err, errManifestMismatch) {
+		t.Errorf("expected errManifestMismatch, got %v", err)
+	}
+	if out.String() != testVerifyResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), testVerifyResult)
+	}
+}
+
+func TestSquarify(t *testing.T) {
+	// the example of the squarified treemaps paper
+	result := squarify([]int64{6, 6, 4, 3, 2, 2, 1}, rect{0, 0, 6, 4})
+	expected := []rect{
+		{0, 0, 3, 2}, {0, 2, 3, 2},
+		{3, 0, 12.0 / 7, 7.0 / 3}, {3 + 12.0/7, 0, 9.0 / 7, 7.0 / 3},
+	}
+	for rectIdx, cell := range expected {
+		got := result[rectIdx]
+		if math.Abs(got.x-cell.x) > 1e-9 || math.Abs(got.y-cell.y) > 1e-9 || math.Abs(got.w-cell.w) > 1e-9 || math.Abs(got.h-cell.h) > 1e-9 {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, cell)
+		}
+	}
+
+	area := 0.0
+	for _, cell := range result {
+		area += cell.w * cell.h
+	}
+	if len(result) != 7 || math.Abs(area-24) > 1e-9 {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, "7 rects of 24 total area")
+	}
+}
+
+func TestTreeSVG(t *testing.T) {
+	result := renderTestTree(t, "testdata", &options{printFiles: true, format: formatSVG})
+	for _, expected := range []string{`<svg xmlns="http://www.w3.org/2000/svg"`, "<title>testdata/project/gopher.png (70372b)</title>", ">gopher.png</text>", "</svg>\n"} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("results not match\nGot:\n%v\nExpected to contain:\n%v", result, expected)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errManifestMismatch = errors.New("manifest mismatch")
+
+const (
+	verifyMissing  = "missing"
+	verifyExtra    = "extra"
+	verifyModified = "modified"
+)
+
+// manifestEntry is a manifest line: "<sha256>  <size>  <path>"
+type manifestEntry struct {
+	Path string
+	Size int64
+	Hash string
+}
+
+func (entry manifestEntry) String() string {
+	return fmt.Sprintf("%s  %d  %s", entry.Hash, entry.Size, entry.Path)
+}
+
+func parseManifestLine(line string) (manifestEntry, error) {
+	fields := strings.SplitN(line, "  ", 3)
+	if len(fields) != 3 || len(fields[0]) != 64 || fields[2] == "" {
+		return manifestEntry{}, errors.New("not a manifest line")
+	}
+
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+
+	return manifestEntry{Path: fields[2], Size: size, Hash: fields[0]}, nil
+}
+
+// buildManifest hashes all files of the tree, sorted by path. Display flags would leave
+// files out, so only the parallelism of the walk is taken from the command line
+func buildManifest(rootPath string, jobs int) ([]manifestEntry, error) {
+	manifestOpts := options{printFiles: true, jobs: jobs}
+	fsys, closeFS, err := openFS(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFS()
+
+	root, err := buildTree(fsys, filepath.Base(rootPath), &manifestOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	bySize := make(map[int64][]string)
+	collectFiles(root, "", bySize)
+
+	entries := make([]manifestEntry, 0)
+	for size, paths := range bySize {
+		for _, filePath := range paths {
+			hash, err := hashFile(fsys, filePath)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, manifestEntry{Path: filePath, Size: size, Hash: hash})
+		}
+	}
+	sort.Slice(entries, func(leftIdx, rightIdx int) bool {
+		return entries[leftIdx].Path < entries[rightIdx].Path
+	})
+
+	return entries, errors.Join(collectErrors(root, nil)...)
+}
+
+func newManifestFlagSet(name string, jobs *int) *flag.FlagSet {
+	flags := flag.NewFlagSet("dirTree "+name, flag.ContinueOnError)
+	flags.IntVar(jobs, "j", 1, "number of directories read in parallel")
+	return flags
+}
+
+func readManifest(manifest io.Reader) (map[string]manifestEntry, error) {
+	entries := make(map[string]manifestEntry)
+	scanner := bufio.NewScanner(manifest)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		if scanner.Text() == "" {
+			continue
+		}
+
+		entry, err := parseManifestLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		entries[entry.Path] = entry
+	}
+
+	return entries, scanner.Err()
+}
+
+// verifyManifest prints "<status> <path>" for every file that does not match, sorted by path
+func verifyManifest(out io.Writer, expected map[string]manifestEntry, entries []manifestEntry) error {
+	mismatches := make(map[string]string)
+	found := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		found[entry.Path] = true
+		expectedEntry, ok := expected[entry.Path]
+		switch {
+		case !ok:
+			mismatches[entry.Path] = verifyExtra
+		case expectedEntry.Size != entry.Size || expectedEntry.Hash != entry.Hash:
+			mismatches[entry.Path] = verifyModified
+		}
+	}
+	for entryPath := range expected {
+		if !found[entryPath] {
+			mismatches[entryPath] = verifyMissing
+		}
+	}
+
+	paths := make([]string, 0, len(mismatches))
+	counts := make(map[string]int)
+	for entryPath, status := range mismatches {
+		paths = append(paths, entryPath)
+		counts[status]++
+	}
+	sort.Strings(paths)
+	for _, entryPath := range paths {
+		fmt.Fprintf(out, "%s %s\n", mismatches[entryPath], entryPath)
+	}
+
+	if len(mismatches) == 0 {
+		fmt.Fprintf(out, "%s ok\n", plural(len(entries), "file", "files"))
+		return nil
+	}
+	return fmt.Errorf("%w: %d missing, %d extra, %d modified", errManifestMismatch,
+		counts[verifyMissing], counts[verifyExtra], counts[verifyModified])
+}
+
+func runManifest(out io.Writer, args []string) error {
+	jobs := 1
+	positional, err := parseFlags(newManifestFlagSet("manifest", &jobs), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+
+	entries, err := buildManifest(positional[0], jobs)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Fprintln(out, entry)
+	}
+
+	return nil
+}
+
+func runVerify(out io.Writer, args []string) error {
+	jobs := 1
+	positional, err := parseFlags(newManifestFlagSet("verify", &jobs), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errUsage
+	}
+
+	manifestFile, err := os.Open(positional[0])
+	if err != nil {
+		return err
+	}
+	defer manifestFile.Close()
+
+	expected, err := readManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	entries, err := buildManifest(positional[1], jobs)
+	if err != nil {
+		return err
+	}
+
+	return verifyManifest(out, expected, entries)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func getOwnerIDs(info os.FileInfo) (string, string, bool) {
+	return "", "", false
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	charsetUnicode = "unicode"
+	charsetASCII   = "ascii"
+)
+
+const (
+	formatText   = "text"
+	formatJSON   = "json"
+	formatXML    = "xml"
+	formatNDJSON = "ndjson"
+)
+
+type renderer func(out io.Writer, root *Node, opts *options) error
+
+var renderers = map[string]renderer{
+	formatText:   renderText,
+	formatJSON:   renderJSON,
+	formatXML:    renderXML,
+	formatNDJSON: renderNDJSON,
+	formatHTML:   renderHTML,
+	formatSVG:    renderSVG,
+}
+
+func getFileSize(node *Node) string {
+	if node.Size == 0 {
+		return " (empty)"
+	}
+
+	return fmt.Sprintf(" (%db)", node.Size)
+}
+
+func getDirUsage(node *Node, opts *options) string {
+	if node.Files == 0 {
+		return " (empty)"
+	}
+
+	files := plural(node.Files, "file", "files")
+	// -h prints the size in its column
+	if opts.humanSizes {
+		return fmt.Sprintf(" (%s)", files)
+	}
+	return fmt.Sprintf(" (%db, %s)", node.Size, files)
+}
+
+// glyphs are the pieces a text tree line is built from
+type glyphs struct {
+	branch     string
+	lastBranch string
+	indent     string
+	lastIndent string
+	ellipsis   string
+}
+
+// getGlyphs keeps the original "├───" and tab layout unless -indent is set
+func getGlyphs(opts *options) glyphs {
+	fork, corner, vertical, dash, ellipsis := "├", "└", "│", "─", "…"
+	if opts.charset == charsetASCII {
+		fork, corner, vertical, dash, ellipsis = "|", "`", "|", "-", "..."
+	}
+
+	if opts.indent < 2 {
+		return glyphs{
+			branch:     fork + strings.Repeat(dash, 3),
+			lastBranch: corner + strings.Repeat(dash, 3),
+			indent:     vertical + "\t",
+			lastIndent: "\t",
+			ellipsis:   ellipsis,
+		}
+	}
+
+	return glyphs{
+		branch:     fork + strings.Repeat(dash, opts.indent-2) + " ",
+		lastBranch: corner + strings.Repeat(dash, opts.indent-2) + " ",
+		indent:     vertical + strings.Repeat(" ", opts.indent-1),
+		lastIndent: strings.Repeat(" ", opts.indent),
+		ellipsis:   ellipsis,
+	}
+}
+
+// getCollapsed describes a dir not expanded because of -filelimit
+func getCollapsed(node *Node, opts *options) string {
+	return fmt.Sprintf(" [%s, %s]", plural(node.Entries, "entry", "entries"), formatBytes(node.Size, opts))
+}
+
+// printTree prints nodes followed by a line for the more entries cut by -head
+func printTree(out io.Writer, nodes []*Node, more int, prevIndent string, cols *columnSet, stats *treeStats, opts *options) {
+	for nodeIdx, node := range nodes {
+		currIndent, nextIndent := prevIndent+opts.glyphs.branch, prevIndent+opts.glyphs.indent
+		if nodeIdx == len(nodes)-1 && more == 0 {
+			currIndent, nextIndent = prevIndent+opts.glyphs.lastBranch, prevIndent+opts.glyphs.lastIndent
+		}
+
+		line := currIndent + cols.format(node) + diffMarkers[node.Status] + opts.colors.paint(node)
+		switch {
+		case node.Target != "":
+			line += " -> " + node.Target
+		case !node.IsDir():
+			if !opts.humanSizes {
+				line += getFileSize(node)
+			}
+		case node.Entries > 0:
+			line += getCollapsed(node, opts)
+		case opts.du:
+			line += getDirUsage(node, opts)
+		}
+		if node.Loc != nil {
+			line += " [" + node.Loc.String() + "]"
+		}
+		if node.Loop {
+			line += " [recursive, not followed]"
+		}
+		if node.Err != "" {
+			line += " [error: " + node.Err + "]"
+		}
+		io.WriteString(out, line+"\n")
+		stats.add(node)
+		stats.addCut(node.cut)
+
+		printTree(out, node.Children, node.More, nextIndent, cols, stats, opts)
+	}
+	if more > 0 {
+		fmt.Fprintf(out, "%s%s and %d more\n", prevIndent+opts.glyphs.lastBranch, opts.glyphs.ellipsis, more)
+	}
+}
+
+func renderText(out io.Writer, root *Node, opts *options) error {
+	textOpts := *opts
+	textOpts.glyphs = getGlyphs(opts)
+	opts = &textOpts
+
+	stats := newTreeStats()
+	stats.addCut(root.cut)
+	printTree(out, root.Children, root.More, "", newColumnSet(root, opts), stats, opts)
+	if opts.report {
+		stats.print(out, opts)
+	}
+	return nil
+}
+
+func renderJSON(out io.Writer, root *Node, opts *options) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(root)
+}
+
+func renderXML(out io.Writer, root *Node, opts *options) error {
+	io.WriteString(out, xml.Header)
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "\t")
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// ndjsonEntry is a flattened Node, one per line
+type ndjsonEntry struct {
+	Path    string     `json:"path"`
+	Name    string     `json:"name"`
+	Type    string     `json:"type"`
+	Size    int64      `json:"size"`
+	Files   int        `json:"files,omitempty"`
+	Target  string     `json:"target,omitempty"`
+	Loop    bool       `json:"loop,omitempty"`
+	Err     string     `json:"error,omitempty"`
+	Status  string     `json:"status,omitempty"`
+	Loc     *LineCount `json:"loc,omitempty"`
+	Entries int        `json:"entries,omitempty"`
+	More    int        `json:"more,omitempty"`
+}
+
+func writeNDJSON(encoder *json.Encoder, nodes []*Node, parentPath string) error {
+	for _, node := range nodes {
+		nodePath := path.Join(parentPath, node.Name)
+		err := encoder.Encode(ndjsonEntry{
+			Path:    nodePath,
+			Name:    node.Name,
+			Type:    node.Type,
+			Size:    node.Size,
+			Files:   node.Files,
+			Target:  node.Target,
+			Loop:    node.Loop,
+			Err:     node.Err,
+			Status:  node.Status,
+			Loc:     node.Loc,
+			Entries: node.Entries,
+			More:    node.More,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = writeNDJSON(encoder, node.Children, nodePath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func renderNDJSON(out io.Writer, root *Node, opts *options) error {
+	return writeNDJSON(json.NewEncoder(out), root.Children, "")
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	errBadSpecLine = errors.New("not a tree line")
+	errBadSpecName = errors.New("bad entry name")
+	errBadSpecTree = errors.New("bad spec tree")
+	// -h, -u, -g and -D drop the annotations the type is told by, -p has it
+	errBadSpecColumns = errors.New("entry type unknown, columns have no permissions (-p)")
+)
+
+var (
+	// trailing annotations printTree adds after names, see printTree
+	specNoteRe  = regexp.MustCompile(` \[[^\]]*\]$`)
+	specFileRe  = regexp.MustCompile(` \((empty|\d+b)\)$`)
+	specUsageRe = regexp.MustCompile(` \(\d+b, \d+ files?\)$`)
+	specMoreRe  = regexp.MustCompile(`^(…|\.\.\.) and \d+ more$`)
+	// metadata columns before names, see columnSet.format, the first one is a mode with -p
+	specColumnsRe = regexp.MustCompile(`^\[([^\]]*)\]  `)
+	specModeRe    = regexp.MustCompile(`^([dalTLDpSugct?]+|-)[rwx-]{9}$`)
+)
+
+// specBranches are the branch glyphs of both charsets, the name follows the dashes
+var specBranches = []string{"├─", "└─", "|-", "`-"}
+
+// specColumn is the display width of the line prefix with 8 wide tabs, so that
+// "│\t" and "\t" of the original layout put siblings on the same column
+func specColumn(prefix string) int {
+	column := 0
+	for _, char := range prefix {
+		if char == '\t' {
+			column += 8 - column%8
+		} else {
+			column++
+		}
+	}
+
+	return column
+}
+
+// specModeType is the entry type of an os.FileMode string
+func specModeType(mode string) string {
+	switch {
+	case strings.HasPrefix(mode, "d"):
+		return nodeDir
+	case strings.Contains(mode[:len(mode)-9], "L"):
+		return nodeLink
+	}
+	return nodeFile
+}
+
+// specBranch is a line split at the corner of its branch glyph
+type specBranch struct {
+	column int
+	dash   string
+	rest   string // after the corner
+	dashes int    // at the start of rest, names may start with dashes too
+}
+
+func findSpecBranch(line string) (specBranch, error) {
+	branchIdx := -1
+	for _, branch := range specBranches {
+		if idx := strings.Index(line, branch); idx != -1 && (branchIdx == -1 || idx < branchIdx) {
+			branchIdx = idx
+		}
+	}
+	if branchIdx == -1 {
+		return specBranch{}, errBadSpecLine
+	}
+
+	corner, cornerLen := utf8.DecodeRuneInString(line[branchIdx:])
+	branch := specBranch{column: specColumn(line[:branchIdx]), dash: "─", rest: line[branchIdx+cornerLen:]}
+	if corner == '|' || corner == '`' {
+		branch.dash = "-"
+	}
+	for strings.HasPrefix(branch.rest[branch.dashes*len(branch.dash):], branch.dash) {
+		branch.dashes++
+	}
+
+	return branch, nil
+}
+
+// specGlyph is the branch glyph all lines share: the corner and 3 dashes in the tab
+// layout, the corner, indent-2 dashes and a space otherwise
+type specGlyph struct {
+	dashes int
+	spaced bool
+}
+
+// findSpecGlyph takes the fewest dashes of all lines for the glyph's, more are the name's
+func findSpecGlyph(branches []specBranch) specGlyph {
+	glyph := specGlyph{dashes: -1, spaced: true}
+	for _, branch := range branches {
+		if glyph.dashes == -1 || branch.dashes < glyph.dashes {
+			glyph.dashes = branch.dashes
+		}
+	}
+	for _, branch := range branches {
+		if branch.dashes == glyph.dashes && !strings.HasPrefix(branch.rest[branch.dashes*len(branch.dash):], " ") {
+			glyph.spaced = false
+		}
+	}
+	if !glyph.spaced {
+		glyph.dashes = 3
+	}
+
+	return glyph
+}
+
+// parseSpecLine reads the entry of a line after the branch glyph
+func parseSpecLine(branch specBranch, glyph specGlyph) (*Node, error) {
+	if branch.dashes < glyph.dashes {
+		return nil, errBadSpecLine
+	}
+	name := branch.rest[glyph.dashes*len(branch.dash):]
+	if glyph.spaced {
+		if !strings.HasPrefix(name, " ") {
+			return nil, errBadSpecLine
+		}
+		name = name[1:]
+	}
+	modeType := ""
+	if columns := specColumnsRe.FindStringSubmatch(name); columns != nil {
+		name = name[len(columns[0]):]
+		cells := strings.Fields(columns[1])
+		if len(cells) == 0 || !specModeRe.MatchString(cells[0]) {
+			return nil, errBadSpecColumns
+		}
+		modeType = specModeType(cells[0])
+	}
+	for _, marker := range diffMarkers {
+		name = strings.TrimPrefix(name, marker)
+	}
+
+	node := &Node{Type: nodeDir}
+	for specNoteRe.MatchString(name) {
+		name = specNoteRe.ReplaceAllString(name, "")
+	}
+	switch {
+	case strings.Contains(name, " -> "):
+		name, node.Target, _ = strings.Cut(name, " -> ")
+		node.Type = nodeLink
+	case specFileRe.MatchString(name):
+		name = specFileRe.ReplaceAllString(name, "")
+		node.Type = nodeFile
+	case specUsageRe.MatchString(name):
+		name = specUsageRe.ReplaceAllString(name, "")
+	}
+	if modeType != "" && node.Type != nodeLink {
+		node.Type = modeType
+	}
+	node.Name = name
+
+	return node, nil
+}
+
+// parseTextSpec reads what printTree prints, up to the totals footer
+func parseTextSpec(spec io.Reader) (*Node, error) {
+	root := &Node{Type: nodeDir}
+	// parents[i] is the dir lines of columns[i] are added to
+	parents, columns := []*Node{root}, []int{-1}
+
+	// the glyph is known once all lines are read
+	branches := make([]specBranch, 0)
+	scanner := bufio.NewScanner(spec)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+
+		branch, err := findSpecBranch(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", len(branches)+1, err)
+		}
+		branches = append(branches, branch)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	glyph := findSpecGlyph(branches)
+	for branchIdx, branch := range branches {
+		node, err := parseSpecLine(branch, glyph)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", branchIdx+1, err)
+		}
+		// entries cut by -head are not known
+		if specMoreRe.MatchString(node.Name) {
+			continue
+		}
+		for branch.column <= columns[len(columns)-1] {
+			parents, columns = parents[:len(parents)-1], columns[:len(columns)-1]
+		}
+
+		parent := parents[len(parents)-1]
+		// only dirs get deeper lines, even ones printed like files
+		parent.Type = nodeDir
+		parent.Children = append(parent.Children, node)
+		parents, columns = append(parents, node), append(columns, branch.column)
+	}
+
+	return root, nil
+}
+
+// parseSpec reads a text tree or, if it starts with "{", a tree saved with -format=json
+func parseSpec(spec []byte) (*Node, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(spec), []byte("{")) {
+		return parseTextSpec(bytes.NewReader(spec))
+	}
+
+	root := &Node{}
+	if err := json.Unmarshal(spec, root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// checkSpecName keeps spec entries inside the target dir
+func checkSpecName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w %q", errBadSpecName, name)
+	}
+	return nil
+}
+
+// checkLinkTarget keeps links inside the target dir, relPath is the link's own path
+func checkLinkTarget(relPath, target string) error {
+	targetPath := path.Join(path.Dir(relPath), target)
+	if target == "" || path.IsAbs(target) || filepath.IsAbs(target) || targetPath == ".." || strings.HasPrefix(targetPath, "../") {
+		return fmt.Errorf("%w: link %s -> %s leads out of the target dir", errBadSpecTree, relPath, target)
+	}
+	return nil
+}
+
+// checkSpecNodes rejects what could lead the scaffold out of the target dir or stop it
+// halfway: entries under links and files, two entries of the same name, a link and a dir
+// say, and links to outside of the target dir
+func checkSpecNodes(nodes []*Node, relPath string, links bool) error {
+	seen := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if err := checkSpecName(node.Name); err != nil {
+			return err
+		}
+		nodeRelPath := path.Join(relPath, node.Name)
+		if seen[node.Name] {
+			return fmt.Errorf("%w: %s is listed twice", errBadSpecTree, nodeRelPath)
+		}
+		seen[node.Name] = true
+		if !node.IsDir() && len(node.Children) > 0 {
+			return fmt.Errorf("%w: %s %s has entries", errBadSpecTree, node.Type, nodeRelPath)
+		}
+		if links && node.Type == nodeLink {
+			if err := checkLinkTarget(nodeRelPath, node.Target); err != nil {
+				return err
+			}
+		}
+
+		if err := checkSpecNodes(node.Children, nodeRelPath, links); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scaffold creates dirs and empty files of the spec inside root, and links if asked to,
+// existing entries are left as they are. root is nil for a dry run
+func scaffold(out io.Writer, nodes []*Node, root *os.Root, relPath string, links bool) error {
+	for _, node := range nodes {
+		nodeRelPath := path.Join(relPath, node.Name)
+		nodePath := filepath.FromSlash(nodeRelPath)
+
+		var err error
+		switch node.Type {
+		case nodeDir:
+			fmt.Fprintf(out, "mkdir %s\n", nodeRelPath)
+			if root != nil {
+				err = root.Mkdir(nodePath, 0755)
+			}
+		case nodeLink:
+			if !links {
+				fmt.Fprintf(out, "skip link %s -> %s\n", nodeRelPath, node.Target)
+				continue
+			}
+			fmt.Fprintf(out, "link %s -> %s\n", nodeRelPath, node.Target)
+			if root != nil {
+				err = root.Symlink(node.Target, nodePath)
+			}
+		default:
+			fmt.Fprintf(out, "create %s\n", nodeRelPath)
+			if root != nil {
+				var file *os.File
+				file, err = root.OpenFile(nodePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+				if err == nil {
+					err = file.Close()
+				}
+			}
+		}
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+
+		if root != nil && len(node.Children) > 0 {
+			// an existing entry of the name may be a link to anywhere
+			info, err := root.Lstat(nodePath)
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("%w: %s exists and is not a directory", errBadSpecTree, nodeRelPath)
+			}
+		}
+		if err = scaffold(out, node.Children, root, nodeRelPath, links); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scaffoldDir checks the whole spec before it creates anything in dirPath
+func scaffoldDir(out io.Writer, specRoot *Node, dirPath string, dryRun, links bool) error {
+	if err := checkSpecNodes(specRoot.Children, "", links); err != nil {
+		return err
+	}
+	if dryRun {
+		return scaffold(out, specRoot.Children, nil, "", links)
+	}
+
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return err
+	}
+	// os.Root refuses paths and links that lead out of the target dir
+	root, err := os.OpenRoot(dirPath)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	return scaffold(out, specRoot.Children, root, "", links)
+}
+
+func runScaffold(out io.Writer, args []string) error {
+	flags := flag.NewFlagSet("dirTree scaffold", flag.ContinueOnError)
+	dryRun := flags.Bool("n", false, "dry run, only print what would be created")
+	links := flags.Bool("links", false, "create links too, their targets have to be inside DIR")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errUsage
+	}
+
+	var spec []byte
+	if positional[0] == "-" {
+		spec, err = io.ReadAll(os.Stdin)
+	} else {
+		spec, err = os.ReadFile(positional[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	specRoot, err := parseSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	return scaffoldDir(out, specRoot, positional[1], *dryRun, *links)
+}
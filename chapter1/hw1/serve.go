@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	errBadPath  = errors.New("bad path")
+	errBadDepth = errors.New("bad depth")
+)
+
+// TreeHandler serves a few levels of the tree per request: GET /tree?path=a/b&depth=1
+type TreeHandler struct {
+	fsys     fs.FS
+	rootName string
+	opts     *options
+}
+
+// NewTreeHandler ...
+func NewTreeHandler(fsys fs.FS, rootName string, opts *options) *TreeHandler {
+	return &TreeHandler{
+		fsys:     fsys,
+		rootName: rootName,
+		opts:     opts,
+	}
+}
+
+// jailPath turns the path param into a name inside fsys, nothing outside of it can be named
+func jailPath(rawPath string) (string, error) {
+	name := strings.Trim(rawPath, "/")
+	if name == "" {
+		return ".", nil
+	}
+	if !fs.ValidPath(name) {
+		return "", errBadPath
+	}
+
+	return name, nil
+}
+
+func parseDepth(rawDepth string, maxDepth int) (int, error) {
+	if rawDepth == "" {
+		return 1, nil
+	}
+
+	depth, err := strconv.Atoi(rawDepth)
+	if err != nil || depth < 1 {
+		return 0, errBadDepth
+	}
+	if maxDepth > 0 && depth > maxDepth {
+		depth = maxDepth
+	}
+
+	return depth, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, response map[string]interface{}) {
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
+
+func (h *TreeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": "method not allowed"})
+		return
+	}
+
+	name, err := jailPath(r.URL.Query().Get("path"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	depth, err := parseDepth(r.URL.Query().Get("depth"), h.opts.maxDepth)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	subFS, err := fs.Sub(h.fsys, name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	// one unreadable dir must not break the whole listing
+	levelOpts := *h.opts
+	levelOpts.maxDepth = depth
+	levelOpts.keepGoing = true
+	// du and loc walk the whole subtree ignoring depth, runServe rejects them
+	levelOpts.du, levelOpts.loc = false, false
+
+	rootName := path.Base(name)
+	if name == "." {
+		rootName = h.rootName
+	}
+	root, err := buildTree(subFS, rootName, &levelOpts)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"error": "not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"response": root})
+}
+
+func runServe(out io.Writer, args []string) error {
+	opts := &options{}
+	flags := newFlagSet(opts)
+	addr := flags.String("addr", ":8080", "listen address")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+	if _, err = checkOptions(opts); err != nil {
+		return err
+	}
+	// totals need whole subtrees, the service lists a level at a time
+	if opts.fullWalk() {
+		return errors.New("serve lists one level at a time, -du, -loc and -format svg are not supported")
+	}
+
+	// os.Root keeps symlinks from leading out of the served dir too
+	root, err := os.OpenRoot(positional[0])
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/tree", NewTreeHandler(root.FS(), filepath.Base(positional[0]), opts))
+
+	return http.ListenAndServe(*addr, mux)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	sortName    = "name"
+	sortVersion = "version"
+	sortSize    = "size"
+	sortMtime   = "mtime"
+)
+
+func isDigit(char byte) bool {
+	return '0' <= char && char <= '9'
+}
+
+// nextChunk splits off a run of digits or a run of non-digits
+func nextChunk(str string) (string, string) {
+	chunkLen := 1
+	for chunkLen < len(str) && isDigit(str[chunkLen]) == isDigit(str[0]) {
+		chunkLen++
+	}
+
+	return str[:chunkLen], str[chunkLen:]
+}
+
+// compareVersion compares digit runs as numbers, so "file2" goes before "file10"
+func compareVersion(left, right string) int {
+	for left != "" && right != "" {
+		var leftChunk, rightChunk string
+		leftChunk, left = nextChunk(left)
+		rightChunk, right = nextChunk(right)
+
+		if isDigit(leftChunk[0]) && isDigit(rightChunk[0]) {
+			leftNum := strings.TrimLeft(leftChunk, "0")
+			rightNum := strings.TrimLeft(rightChunk, "0")
+			if len(leftNum) != len(rightNum) {
+				return len(leftNum) - len(rightNum)
+			}
+			leftChunk, rightChunk = leftNum, rightNum
+		}
+		if cmp := strings.Compare(leftChunk, rightChunk); cmp != 0 {
+			return cmp
+		}
+	}
+
+	return len(left) - len(right)
+}
+
+// compareNodes returns a negative number when left goes first
+func compareNodes(left, right *Node, sortBy string) int {
+	switch sortBy {
+	case sortVersion:
+		return compareVersion(left.Name, right.Name)
+	case sortSize:
+		// largest first
+		if left.Size != right.Size {
+			if left.Size > right.Size {
+				return -1
+			}
+			return 1
+		}
+	case sortMtime:
+		// newest first
+		if !left.ModTime.Equal(right.ModTime) {
+			if left.ModTime.After(right.ModTime) {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(left.Name, right.Name)
+}
+
+func checkSortBy(sortBy string) error {
+	switch sortBy {
+	case "", sortName, sortVersion, sortSize, sortMtime:
+		return nil
+	}
+
+	return fmt.Errorf("unknown sort %q", sortBy)
+}
+
+func sortNodes(nodes []*Node, opts *options) {
+	sort.SliceStable(nodes, func(leftIdx, rightIdx int) bool {
+		left, right := nodes[leftIdx], nodes[rightIdx]
+		if opts.dirsFirst && left.IsDir() != right.IsDir() {
+			return left.IsDir()
+		}
+
+		cmp := compareNodes(left, right, opts.sortBy)
+		if opts.reverse {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+)
+
+const noExtension = "(none)"
+
+// extStats is the line of the -stats breakdown
+type extStats struct {
+	Ext   string
+	Files int
+	Bytes int64
+}
+
+// treeStats is counted while the text tree is printed
+type treeStats struct {
+	dirs  int
+	files int
+	bytes int64
+	// entries cut by -head are in the footer, not in the breakdowns
+	cutDirs  int
+	cutFiles int
+	cutBytes int64
+	byExt    map[string]*extStats
+	byLang   map[string]*LineCount
+}
+
+func newTreeStats() *treeStats {
+	return &treeStats{
+		byExt:  make(map[string]*extStats),
+		byLang: make(map[string]*LineCount),
+	}
+}
+
+func (stats *treeStats) add(node *Node) {
+	if node.IsDir() {
+		stats.dirs++
+		// files of dirs collapsed by -filelimit are not listed
+		if node.Entries > 0 {
+			stats.bytes += node.Size
+		}
+		return
+	}
+
+	stats.files++
+	if node.Type != nodeFile {
+		return
+	}
+	stats.bytes += node.Size
+
+	ext := path.Ext(node.Name)
+	if ext == "" {
+		ext = noExtension
+	}
+	if _, ok := stats.byExt[ext]; !ok {
+		stats.byExt[ext] = &extStats{Ext: ext}
+	}
+	stats.byExt[ext].Files++
+	stats.byExt[ext].Bytes += node.Size
+
+	if node.Loc != nil {
+		if _, ok := stats.byLang[node.Loc.Language]; !ok {
+			stats.byLang[node.Loc.Language] = &LineCount{Language: node.Loc.Language}
+		}
+		stats.byLang[node.Loc.Language].add(node.Loc)
+	}
+}
+
+// addCut counts nodes cut by -head and all their subtrees, the way add counts printed ones
+func (stats *treeStats) addCut(nodes []*Node) {
+	for _, node := range nodes {
+		switch {
+		case node.IsDir():
+			stats.cutDirs++
+			if node.Entries > 0 {
+				stats.cutBytes += node.Size
+			}
+		case node.Type == nodeFile:
+			stats.cutFiles++
+			stats.cutBytes += node.Size
+		default:
+			stats.cutFiles++
+		}
+		stats.addCut(node.Children)
+	}
+}
+
+func plural(count int, one string, many string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, one)
+	}
+	return fmt.Sprintf("%d %s", count, many)
+}
+
+// formatBytes is a size outside the aligned column, where a bare number would have no unit
+func formatBytes(size int64, opts *options) string {
+	if opts.humanSizes && size >= 1024 {
+		return humanSize(size)
+	}
+	if opts.humanSizes {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%db", size)
+}
+
+// extensions are sorted by bytes, the largest first
+func (stats *treeStats) extensions() []*extStats {
+	exts := make([]*extStats, 0, len(stats.byExt))
+	for _, ext := range stats.byExt {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(leftIdx, rightIdx int) bool {
+		left, right := exts[leftIdx], exts[rightIdx]
+		if left.Bytes != right.Bytes {
+			return left.Bytes > right.Bytes
+		}
+		return left.Ext < right.Ext
+	})
+
+	return exts
+}
+
+func (stats *treeStats) print(out io.Writer, opts *options) {
+	fmt.Fprintf(out, "\n%s, %s, %s", plural(stats.dirs, "directory", "directories"), plural(stats.files, "file", "files"), formatBytes(stats.bytes, opts))
+	if stats.cutDirs > 0 || stats.cutFiles > 0 {
+		io.WriteString(out, " (and ")
+		if stats.cutDirs > 0 {
+			fmt.Fprintf(out, "%s, ", plural(stats.cutDirs, "directory", "directories"))
+		}
+		fmt.Fprintf(out, "%s, %s more)", plural(stats.cutFiles, "file", "files"), formatBytes(stats.cutBytes, opts))
+	}
+	io.WriteString(out, "\n")
+	if opts.stats {
+		for _, ext := range stats.extensions() {
+			fmt.Fprintf(out, "%s\t%s\t%s\n", ext.Ext, plural(ext.Files, "file", "files"), formatBytes(ext.Bytes, opts))
+		}
+	}
+	if opts.loc {
+		for _, lang := range stats.languages() {
+			fmt.Fprintf(out, "%s\t%s\n", lang.Language, lang)
+		}
+	}
+}
+
+// languages are sorted by lines, the most first
+func (stats *treeStats) languages() []*LineCount {
+	langs := make([]*LineCount, 0, len(stats.byLang))
+	for _, lang := range stats.byLang {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(leftIdx, rightIdx int) bool {
+		left, right := langs[leftIdx], langs[rightIdx]
+		if left.Lines != right.Lines {
+			return left.Lines > right.Lines
+		}
+		return left.Language < right.Language
+	})
+
+	return langs
+}
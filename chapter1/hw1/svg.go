@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"math"
+	"path"
+	"sort"
+)
+
+const formatSVG = "svg"
+
+const (
+	svgWidth      = 1200
+	svgHeight     = 800
+	svgHeader     = 16 // dir name strip above its children
+	svgPadding    = 2
+	svgMinSide    = 3 // dirs with less room inside are drawn without children
+	svgCharWidth  = 7
+	svgLabelSpace = 13
+)
+
+// rect is a treemap cell, in pixels
+type rect struct {
+	x, y, w, h float64
+}
+
+// worstRatio is the worst aspect ratio of a row of areas laid along side
+func worstRatio(row []float64, side float64) float64 {
+	sum, maxArea, minArea := 0.0, 0.0, math.MaxFloat64
+	for _, area := range row {
+		sum += area
+		maxArea = math.Max(maxArea, area)
+		minArea = math.Min(minArea, area)
+	}
+
+	return math.Max(side*side*maxArea/(sum*sum), sum*sum/(side*side*minArea))
+}
+
+// layoutRow places a row along the shorter side of bounds and returns what is left of bounds
+func layoutRow(row []float64, bounds rect, rects []rect) (rect, []rect) {
+	sum := 0.0
+	for _, area := range row {
+		sum += area
+	}
+
+	if bounds.w >= bounds.h {
+		width := sum / bounds.h
+		y := bounds.y
+		for _, area := range row {
+			rects = append(rects, rect{bounds.x, y, width, area / width})
+			y += area / width
+		}
+		return rect{bounds.x + width, bounds.y, bounds.w - width, bounds.h}, rects
+	}
+
+	height := sum / bounds.w
+	x := bounds.x
+	for _, area := range row {
+		rects = append(rects, rect{x, bounds.y, area / height, height})
+		x += area / height
+	}
+	return rect{bounds.x, bounds.y + height, bounds.w, bounds.h - height}, rects
+}
+
+// squarify lays out sizes sorted largest first, keeping cells close to squares (Bruls, Huizing, van Wijk)
+func squarify(sizes []int64, bounds rect) []rect {
+	total := int64(0)
+	for _, size := range sizes {
+		total += size
+	}
+	rects := make([]rect, 0, len(sizes))
+	if total == 0 || bounds.w <= 0 || bounds.h <= 0 {
+		return rects
+	}
+
+	scale := bounds.w * bounds.h / float64(total)
+	row := make([]float64, 0)
+	for _, size := range sizes {
+		area := float64(size) * scale
+		side := math.Min(bounds.w, bounds.h)
+		if len(row) > 0 && worstRatio(append(row, area), side) > worstRatio(row, side) {
+			bounds, rects = layoutRow(row, bounds, rects)
+			row = row[:0]
+		}
+		row = append(row, area)
+	}
+	_, rects = layoutRow(row, bounds, rects)
+
+	return rects
+}
+
+// svgColor gives files of the same extension the same hue
+func svgColor(node *Node) string {
+	if node.IsDir() {
+		return "#eeeeee"
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(path.Ext(node.Name)))
+	return fmt.Sprintf("hsl(%d, 55%%, 70%%)", hash.Sum32()%360)
+}
+
+func writeSVGNode(out io.Writer, node *Node, nodePath string, cell rect, opts *options) {
+	fmt.Fprintf(out, "<g><title>%s (%s)</title>\n", html.EscapeString(nodePath), formatBytes(node.Size, opts))
+	fmt.Fprintf(out, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\"/>\n",
+		cell.x, cell.y, cell.w, cell.h, svgColor(node))
+	if cell.w >= float64(len(node.Name)*svgCharWidth) && cell.h >= svgLabelSpace {
+		fmt.Fprintf(out, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", cell.x+svgPadding, cell.y+svgLabelSpace-2, html.EscapeString(node.Name))
+	}
+	fmt.Fprint(out, "</g>\n")
+
+	inner := rect{cell.x + svgPadding, cell.y + svgHeader, cell.w - 2*svgPadding, cell.h - svgHeader - svgPadding}
+	if inner.w < svgMinSide || inner.h < svgMinSide {
+		return
+	}
+	writeSVGChildren(out, node.Children, nodePath, inner, opts)
+}
+
+func writeSVGChildren(out io.Writer, nodes []*Node, parentPath string, bounds rect, opts *options) {
+	// empty entries take no area
+	sized := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Size > 0 {
+			sized = append(sized, node)
+		}
+	}
+	sort.SliceStable(sized, func(leftIdx, rightIdx int) bool {
+		return sized[leftIdx].Size > sized[rightIdx].Size
+	})
+
+	sizes := make([]int64, len(sized))
+	for nodeIdx, node := range sized {
+		sizes[nodeIdx] = node.Size
+	}
+	for nodeIdx, cell := range squarify(sizes, bounds) {
+		if cell.w < 1 || cell.h < 1 {
+			continue
+		}
+		node := sized[nodeIdx]
+		writeSVGNode(out, node, path.Join(parentPath, node.Name), cell, opts)
+	}
+}
+
+// renderSVG draws a treemap of du sizes, checkOptions turns -du on for it
+func renderSVG(out io.Writer, root *Node, opts *options) error {
+	io.WriteString(out, xml.Header)
+	fmt.Fprintf(out, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		svgWidth, svgHeight, svgWidth, svgHeight)
+	fmt.Fprint(out, "<style>rect { stroke: #555; stroke-width: 0.5; } text { font: 11px monospace; fill: #222; }</style>\n")
+	writeSVGNode(out, root, root.Name, rect{0, 0, svgWidth, svgHeight}, opts)
+	_, err := fmt.Fprint(out, "</svg>\n")
+	return err
+}
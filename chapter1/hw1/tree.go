@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	nodeDir  = "dir"
+	nodeFile = "file"
+	nodeLink = "link"
+)
+
+// Node ...
+type Node struct {
+	XMLName  xml.Name   `json:"-" xml:"node"`
+	Name     string     `json:"name" xml:"name,attr"`
+	Type     string     `json:"type" xml:"type,attr"` // dir|file|link, followed dir links are dirs
+	Size     int64      `json:"size" xml:"size,attr"`
+	Files    int        `json:"files,omitempty" xml:"files,attr,omitempty"` // du mode only
+	Target   string     `json:"target,omitempty" xml:"target,attr,omitempty"`
+	Loop     bool       `json:"loop,omitempty" xml:"loop,attr,omitempty"`
+	Err      string     `json:"error,omitempty" xml:"error,attr,omitempty"`
+	Status   string     `json:"status,omitempty" xml:"status,attr,omitempty"`   // diff mode only
+	Loc      *LineCount `json:"loc,omitempty" xml:"loc,omitempty"`              // loc mode only
+	Entries  int        `json:"entries,omitempty" xml:"entries,attr,omitempty"` // -filelimit collapsed dirs only
+	More     int        `json:"more,omitempty" xml:"more,attr,omitempty"`       // children cut by -head
+	ModTime  time.Time  `json:"mtime,omitzero" xml:"-"`
+	Children []*Node    `json:"children,omitempty" xml:"node"`
+
+	err  error
+	info os.FileInfo // lstat info, for metadata columns
+	cut  []*Node     // children cut by -head, counted in the totals footer
+}
+
+// IsDir ...
+func (node *Node) IsDir() bool {
+	return node.Type == nodeDir
+}
+
+func newNode(objInfo os.FileInfo) *Node {
+	node := &Node{
+		Name:    objInfo.Name(),
+		Type:    nodeFile,
+		Size:    objInfo.Size(),
+		ModTime: objInfo.ModTime(),
+		info:    objInfo,
+	}
+	if objInfo.IsDir() {
+		node.Type = nodeDir
+		node.Size = 0
+	} else if objInfo.Mode()&os.ModeSymlink != 0 {
+		node.Type = nodeLink
+		node.Size = 0
+	}
+
+	return node
+}
+
+// walkState is what a directory passes down to its children
+type walkState struct {
+	fsys    fs.FS
+	relPath string // slash separated, relative to the tree root
+	depth   int
+	rules   []ignoreRule
+	parents []os.FileInfo // dirs on the way from the root, to detect link loops
+}
+
+func (state walkState) child(name string) walkState {
+	return walkState{
+		fsys:    state.fsys,
+		relPath: path.Join(state.relPath, name),
+		depth:   state.depth + 1,
+		rules:   state.rules,
+		parents: state.parents,
+	}
+}
+
+// fsPath is the name of the entry inside fsys
+func (state walkState) fsPath() string {
+	if state.relPath == "" {
+		return "."
+	}
+	return state.relPath
+}
+
+// failNode either stops the walk or, with -k, keeps the entry annotated with the error
+func failNode(node *Node, err error, opts *options) (*Node, error) {
+	if !opts.keepGoing {
+		return nil, err
+	}
+
+	node.err = err
+	node.Err = err.Error()
+	if pathErr, ok := err.(*os.PathError); ok {
+		node.Err = pathErr.Err.Error()
+	}
+
+	return node, nil
+}
+
+func collectErrors(node *Node, errs []error) []error {
+	if node.err != nil {
+		errs = append(errs, node.err)
+	}
+	for _, child := range node.Children {
+		errs = collectErrors(child, errs)
+	}
+
+	return errs
+}
+
+// resolveLink fills link target, returns target info if the link has to be walked as a dir
+func resolveLink(node *Node, state walkState, opts *options) (os.FileInfo, error) {
+	target, err := fs.ReadLink(state.fsys, state.fsPath())
+	// a filesystem without links support shows the link as it is
+	if errors.Is(err, fs.ErrInvalid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	node.Target = target
+
+	if !opts.followLinks {
+		return nil, nil
+	}
+	// broken links and links to files are left as they are
+	targetInfo, err := fs.Stat(state.fsys, state.fsPath())
+	if err != nil || !targetInfo.IsDir() {
+		return nil, nil
+	}
+
+	return targetInfo, nil
+}
+
+func readDir(state walkState, opts *options) ([]os.FileInfo, []ignoreRule, error) {
+	rules := state.rules
+	if opts.gitignore {
+		dirRules, err := readIgnoreRules(state.fsys, state.relPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		// copy so that siblings do not see each other's rules
+		rules = append(append([]ignoreRule{}, rules...), dirRules...)
+	}
+
+	entries, err := fs.ReadDir(state.fsys, state.fsPath())
+	if err != nil {
+		return nil, nil, err
+	}
+	innerObjs := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		innerObj, err := entry.Info()
+		// removed since it was listed
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		innerObjs = append(innerObjs, innerObj)
+	}
+
+	return filterEntries(innerObjs, state.relPath, rules, opts), rules, nil
+}
+
+// visitNode does the filesystem calls of one entry. It returns the entries of a dir
+// to walk next, with the state they are walked in, and nil for anything else
+func visitNode(state walkState, objInfo os.FileInfo, opts *options) (*Node, walkState, []os.FileInfo, error) {
+	node := newNode(objInfo)
+	if node.Type == nodeLink {
+		targetInfo, err := resolveLink(node, state, opts)
+		if err != nil {
+			node, err = failNode(node, err, opts)
+			return node, state, nil, err
+		}
+		if targetInfo == nil {
+			return node, state, nil, nil
+		}
+		objInfo = targetInfo
+		node.Type = nodeDir
+	}
+	if node.Type == nodeFile && opts.loc {
+		loc, err := countLines(state.fsys, state.fsPath())
+		if err != nil {
+			node, err = failNode(node, err, opts)
+			return node, state, nil, err
+		}
+		node.Loc = loc
+	}
+	if !node.IsDir() {
+		return node, state, nil, nil
+	}
+
+	for _, parent := range state.parents {
+		if sameFile(parent, objInfo) {
+			node.Loop = true
+			return node, state, nil, nil
+		}
+	}
+	// full slice expression makes append copy, siblings must not share parents
+	state.parents = append(state.parents[:len(state.parents):len(state.parents)], objInfo)
+
+	// du and loc need the whole subtree, it is cut to depth afterwards by trimTree
+	if !opts.fullWalk() && opts.maxDepth > 0 && state.depth >= opts.maxDepth {
+		return node, state, nil, nil
+	}
+
+	innerObjs, rules, err := readDir(state, opts)
+	if err != nil {
+		node, err = failNode(node, err, opts)
+		return node, state, nil, err
+	}
+	state.rules = rules
+	// dir totals need the walk, full walks are collapsed afterwards by limitTree
+	if !opts.fullWalk() && opts.fileLimit > 0 && state.depth > 0 && len(innerObjs) > opts.fileLimit {
+		collapseDir(node, innerObjs)
+		return node, state, nil, nil
+	}
+
+	return node, state, innerObjs, nil
+}
+
+// finishDir keeps the walked children to show and computes dir totals
+func finishDir(node *Node, children []*Node, opts *options) {
+	node.Children = make([]*Node, 0, len(children))
+	for _, child := range children {
+		// links were kept by filterFiles in case they lead to a dir
+		if !opts.printFiles && !opts.fullWalk() && !child.IsDir() {
+			continue
+		}
+		// dirs beyond the depth limit have nil children and are not pruned
+		if opts.prune && child.IsDir() && child.Children != nil && len(child.Children) == 0 {
+			continue
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	if opts.du {
+		sumUsage(node)
+	}
+	if opts.loc {
+		sumLines(node)
+	}
+	sortNodes(node.Children, opts)
+}
+
+// walkTree is the sequential walk, it stops at the first error
+func walkTree(state walkState, objInfo os.FileInfo, opts *options) (*Node, error) {
+	node, state, innerObjs, err := visitNode(state, objInfo, opts)
+	if err != nil || innerObjs == nil {
+		return node, err
+	}
+
+	children := make([]*Node, len(innerObjs))
+	for innerObjIdx, innerObj := range innerObjs {
+		children[innerObjIdx], err = walkTree(state.child(innerObj.Name()), innerObj, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	finishDir(node, children, opts)
+
+	return node, nil
+}
+
+// sumUsage computes dir size and file count from already summed children
+func sumUsage(node *Node) {
+	node.Size, node.Files = 0, 0
+	for _, child := range node.Children {
+		node.Size += child.Size
+		if child.IsDir() {
+			node.Files += child.Files
+		} else if child.Type == nodeFile {
+			node.Files++
+		}
+	}
+}
+
+// trimTree drops what du and loc modes had to walk but should not be shown
+func trimTree(node *Node, depth int, opts *options) {
+	if opts.maxDepth > 0 && depth >= opts.maxDepth {
+		node.Children = nil
+		return
+	}
+
+	if !opts.printFiles {
+		node.Children = filterNodes(node.Children)
+	}
+	for _, child := range node.Children {
+		trimTree(child, depth+1, opts)
+	}
+}
+
+// collapseDir keeps only the entry count and the size of files right inside the dir
+func collapseDir(node *Node, innerObjs []os.FileInfo) {
+	node.Entries = len(innerObjs)
+	for _, innerObj := range innerObjs {
+		if innerObj.Mode().IsRegular() {
+			node.Size += innerObj.Size()
+		}
+	}
+}
+
+// limitTree applies -filelimit to fully walked trees and -head to all of them, the root is never collapsed
+func limitTree(node *Node, opts *options) {
+	if opts.head > 0 && len(node.Children) > opts.head {
+		node.More = len(node.Children) - opts.head
+		node.Children, node.cut = node.Children[:opts.head], node.Children[opts.head:]
+	}
+
+	for _, child := range node.Children {
+		if opts.fullWalk() && opts.fileLimit > 0 && len(child.Children) > opts.fileLimit {
+			child.Entries = len(child.Children)
+			child.Children = nil
+			continue
+		}
+		limitTree(child, opts)
+	}
+}
+
+func filterNodes(nodes []*Node) []*Node {
+	tmpNodes := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.IsDir() {
+			tmpNodes = append(tmpNodes, node)
+		}
+	}
+
+	return tmpNodes
+}
+
+// buildTree walks fsys and returns the in-memory tree shared by all renderers
+func buildTree(fsys fs.FS, rootName string, opts *options) (*Node, error) {
+	rootStat, err := fs.Stat(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	rootState := walkState{fsys: fsys}
+	walk := walkTree
+	if opts.jobs > 1 {
+		walk = walkParallel
+	}
+
+	root, err := walk(rootState, rootStat, opts)
+	if err != nil {
+		return nil, err
+	}
+	root.Name = rootName
+	if opts.fullWalk() {
+		trimTree(root, 0, opts)
+	}
+	if opts.fileLimit > 0 || opts.head > 0 {
+		limitTree(root, opts)
+	}
+
+	return root, nil
+}
+
+// buildPathTree walks a directory or an archive
+func buildPathTree(rootPath string, opts *options) (*Node, error) {
+	fsys, closeFS, err := openFS(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFS()
+
+	return buildTree(fsys, filepath.Base(rootPath), opts)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// walkResult is filled by the worker that visits the entry, children are slots
+// for the entries of a dir in readDir order
+type walkResult struct {
+	node     *Node
+	err      error
+	children []*walkResult
+}
+
+type walkTask struct {
+	state   walkState
+	objInfo os.FileInfo
+	result  *walkResult
+}
+
+// walkPool is a queue of entries to visit shared by a fixed number of workers,
+// workers add the entries of the dirs they read
+type walkPool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	tasks   []walkTask
+	pending int // tasks queued or being visited
+}
+
+func (pool *walkPool) push(tasks ...walkTask) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.tasks = append(pool.tasks, tasks...)
+	pool.pending += len(tasks)
+	pool.cond.Broadcast()
+}
+
+// pop takes the last task, so that the walk goes deep first and the queue stays short.
+// It returns false when the queue is empty and no task can add more
+func (pool *walkPool) pop() (walkTask, bool) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for len(pool.tasks) == 0 && pool.pending > 0 {
+		pool.cond.Wait()
+	}
+	if len(pool.tasks) == 0 {
+		return walkTask{}, false
+	}
+
+	task := pool.tasks[len(pool.tasks)-1]
+	pool.tasks = pool.tasks[:len(pool.tasks)-1]
+	return task, true
+}
+
+func (pool *walkPool) done() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.pending--
+	if pool.pending == 0 {
+		pool.cond.Broadcast()
+	}
+}
+
+func (pool *walkPool) visit(task walkTask, opts *options) {
+	defer pool.done()
+
+	node, state, innerObjs, err := visitNode(task.state, task.objInfo, opts)
+	task.result.node, task.result.err = node, err
+	if innerObjs == nil {
+		return
+	}
+
+	task.result.children = make([]*walkResult, len(innerObjs))
+	tasks := make([]walkTask, len(innerObjs))
+	for innerObjIdx, innerObj := range innerObjs {
+		task.result.children[innerObjIdx] = &walkResult{}
+		tasks[innerObjIdx] = walkTask{state.child(innerObj.Name()), innerObj, task.result.children[innerObjIdx]}
+	}
+	pool.push(tasks...)
+}
+
+// collect builds the tree once all entries are visited, with the first error in walk
+// order, the one the sequential walk would return
+func (result *walkResult) collect(opts *options) (*Node, error) {
+	if result.err != nil || result.children == nil {
+		return result.node, result.err
+	}
+
+	children := make([]*Node, len(result.children))
+	for childIdx, child := range result.children {
+		var err error
+		if children[childIdx], err = child.collect(opts); err != nil {
+			return nil, err
+		}
+	}
+	finishDir(result.node, children, opts)
+
+	return result.node, nil
+}
+
+// walkParallel visits entries on -j goroutines, however large the tree is
+func walkParallel(state walkState, objInfo os.FileInfo, opts *options) (*Node, error) {
+	pool := &walkPool{}
+	pool.cond = sync.NewCond(&pool.mu)
+	root := &walkResult{}
+	pool.push(walkTask{state, objInfo, root})
+
+	var wg sync.WaitGroup
+	for workerIdx := 0; workerIdx < opts.jobs; workerIdx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task, ok := pool.pop(); ok; task, ok = pool.pop() {
+				pool.visit(task, opts)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return root.collect(opts)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// cloneTree copies nodes, diffTrees marks and merges into the tree it gets
+func cloneTree(node *Node) *Node {
+	clone := *node
+	if node.Children != nil {
+		clone.Children = make([]*Node, 0, len(node.Children))
+		for _, child := range node.Children {
+			clone.Children = append(clone.Children, cloneTree(child))
+		}
+	}
+
+	return &clone
+}
+
+func hasChanges(node *Node) bool {
+	if node.Status != "" {
+		return true
+	}
+	for _, child := range node.Children {
+		if hasChanges(child) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func flush(out io.Writer) {
+	if flusher, ok := out.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+}
+
+// reportErrors prints errors kept by -k, a watch goes on after them
+func reportErrors(errOut io.Writer, root *Node) {
+	for _, err := range collectErrors(root, nil) {
+		fmt.Fprintln(errOut, err)
+	}
+}
+
+// treeWatcher keeps the last rendered tree to compare with
+type treeWatcher struct {
+	rootPath string
+	opts     *options
+	render   renderer
+	prevRoot *Node
+	errOut   io.Writer
+}
+
+func newTreeWatcher(out, errOut io.Writer, rootPath string, opts *options) (*treeWatcher, error) {
+	render, err := checkOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := buildPathTree(rootPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = render(out, root, opts); err != nil {
+		return nil, err
+	}
+	flush(out)
+	reportErrors(errOut, root)
+
+	return &treeWatcher{rootPath: rootPath, opts: opts, render: render, prevRoot: root, errOut: errOut}, nil
+}
+
+// poll re-renders the tree if something was added, removed or modified since the previous render.
+// A walk that fails, on entries removed while it reads them say, is reported and retried next tick
+func (watcher *treeWatcher) poll(out io.Writer, tick time.Time) error {
+	currRoot, err := buildPathTree(watcher.rootPath, watcher.opts)
+	if err != nil {
+		fmt.Fprintln(watcher.errOut, err)
+		return nil
+	}
+
+	merged := diffTrees(watcher.prevRoot, cloneTree(currRoot), watcher.opts)
+	watcher.prevRoot = currRoot
+	if !hasChanges(merged) {
+		return nil
+	}
+
+	fmt.Fprintf(out, "\n--- %s ---\n", tick.Format("15:04:05"))
+	if err = watcher.render(out, merged, watcher.opts); err != nil {
+		return err
+	}
+	flush(out)
+	// removed entries of the merged tree keep errors already reported
+	reportErrors(watcher.errOut, currRoot)
+
+	return nil
+}
+
+func watchTree(out, errOut io.Writer, rootPath string, opts *options, ticks <-chan time.Time) error {
+	watcher, err := newTreeWatcher(out, errOut, rootPath, opts)
+	if err != nil {
+		return err
+	}
+
+	for tick := range ticks {
+		if err = watcher.poll(out, tick); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"hash/crc32"
+	"reflect"
 	"strconv"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"./pipeline"
 )
 
 /*
@@ -147,3 +152,399 @@ func TestSigner(t *testing.T) {
 	}
 
 }
+
+func TestPipelineContextError(t *testing.T) {
+	errStage := errors.New("stage failed")
+	var sent uint32
+	ctxJobs := []ctxJob{
+		// endless source, stops only on cancel
+		ctxJob(func(ctx context.Context, in, out chan interface{}) error {
+			for num := 0; ; num++ {
+				if err := sendContext(ctx, out, num); err != nil {
+					return err
+				}
+				atomic.AddUint32(&sent, 1)
+			}
+		}),
+		ctxJob(func(ctx context.Context, in, out chan interface{}) error {
+			for rawData := range in {
+				if rawData.(int) == 3 {
+					return errStage
+				}
+				if err := sendContext(ctx, out, rawData); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		// ignores ctx, has to be stopped by closing in
+		ctxJob(func(ctx context.Context, in, out chan interface{}) error {
+			for range in {
+			}
+			return nil
+		}),
+	}
+
+	err := ExecutePipelineContext(context.Background(), ctxJobs...)
+	if err != errStage {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", err, errStage)
+	}
+	if atomic.LoadUint32(&sent) < 4 {
+		t.Errorf("source stopped before the error, sent = %d", sent)
+	}
+}
+
+func TestPipelineContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ctxJobs := []ctxJob{
+		// stuck stage, would hang ExecutePipeline forever
+		ctxJob(func(ctx context.Context, in, out chan interface{}) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		ctxJob(func(ctx context.Context, in, out chan interface{}) error {
+			for range in {
+			}
+			return nil
+		}),
+	}
+
+	start := time.Now()
+	err := ExecutePipelineContext(ctx, ctxJobs...)
+	if err != context.DeadlineExceeded {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", err, context.DeadlineExceeded)
+	}
+	if end := time.Since(start); end > time.Second {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, time.Second)
+	}
+}
+
+func TestSignerOrdered(t *testing.T) {
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+	testExpected := map[int]string{
+		0: "29568666068035183841425683795340791879727309630931025356555",
+		1: "4958044192186797981418233587017209679042592862002427381542",
+		2: "4958044192186797981418233587017209679042592862002427381542",
+	}
+
+	results := make([]Sequenced, 0, len(inputData))
+	hashSignJobs := []job{
+		job(func(in, out chan interface{}) {
+			for _, fibNum := range inputData {
+				out <- fibNum
+			}
+		}),
+		job(SingleHashOrdered),
+		job(MultiHashOrdered),
+		job(func(in, out chan interface{}) {
+			for dataRaw := range in {
+				results = append(results, dataRaw.(Sequenced))
+			}
+		}),
+	}
+
+	start := time.Now()
+	ExecutePipeline(hashSignJobs...)
+	end := time.Since(start)
+
+	if len(results) != len(inputData) {
+		t.Fatalf("results not match\nGot: %v\nExpected: %d results", results, len(inputData))
+	}
+	for resultIdx, result := range results {
+		if result.Seq != resultIdx {
+			t.Errorf("results not match\nGot: %v\nExpected: seq %d", result, resultIdx)
+		}
+		if expected, ok := testExpected[resultIdx]; ok && result.Data != expected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", result.Data, expected)
+		}
+	}
+	if end > 3*time.Second {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, time.Second*3)
+	}
+}
+
+func TestReorderBuffer(t *testing.T) {
+	out := make(chan interface{}, 10)
+	buffer := &reorderBuffer{pending: make(map[int]Sequenced)}
+	for _, readIdx := range []int{2, 0, 3, 1, 4} {
+		buffer.push(readIdx, Sequenced{Seq: readIdx, Data: readIdx}, out)
+	}
+	close(out)
+
+	expectedSeq := 0
+	for rawData := range out {
+		if item := rawData.(Sequenced); item.Seq != expectedSeq {
+			t.Errorf("results not match\nGot: %v\nExpected: seq %d", item.Seq, expectedSeq)
+		}
+		expectedSeq++
+	}
+	if expectedSeq != 5 {
+		t.Errorf("results not match\nGot: %d items\nExpected: 5 items", expectedSeq)
+	}
+}
+
+func TestSignerOrderedGaps(t *testing.T) {
+	origCrc32 := DataSignerCrc32
+	defer func() {
+		DataSignerCrc32 = origCrc32
+	}()
+	DataSignerCrc32 = func(data string) string {
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data))), 10)
+	}
+
+	// Seq that does not start at 0, has gaps or is shuffled keeps the read order
+	inputSeqs := []int{1, 2, 5, 4}
+	results := make([]Sequenced, 0)
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, seq := range inputSeqs {
+				out <- Sequenced{Seq: seq, Data: seq}
+			}
+		}),
+		job(MultiHashOrdered),
+		job(func(in, out chan interface{}) {
+			for dataRaw := range in {
+				results = append(results, dataRaw.(Sequenced))
+			}
+		}),
+	)
+
+	if len(results) != len(inputSeqs) {
+		t.Fatalf("results not match\nGot: %v\nExpected: %d results", results, len(inputSeqs))
+	}
+	for resultIdx, result := range results {
+		if result.Seq != inputSeqs[resultIdx] || result.Data != multiHash(inputSeqs[resultIdx], ThLimit) {
+			t.Errorf("results not match\nGot: %v\nExpected: seq %d", result, inputSeqs[resultIdx])
+		}
+	}
+}
+
+func TestSignerOrderedInFlight(t *testing.T) {
+	origCrc32 := DataSignerCrc32
+	defer func() {
+		DataSignerCrc32 = origCrc32
+	}()
+	DataSignerCrc32 = func(data string) string {
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data))), 10)
+	}
+
+	// in-flight places are freed in read order, shuffled Seq must not block the next read
+	results := make([]Sequenced, 0)
+	doneCh := make(chan struct{})
+	go func() {
+		ExecutePipeline(
+			job(func(in, out chan interface{}) {
+				out <- Sequenced{Seq: 1, Data: 1}
+				out <- Sequenced{Seq: 0, Data: 0}
+			}),
+			NewMultiHashOrdered(SignerOptions{MultiHash: StageOptions{MaxInFlight: 1}}),
+			job(func(in, out chan interface{}) {
+				for dataRaw := range in {
+					results = append(results, dataRaw.(Sequenced))
+				}
+			}),
+		)
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ordered stage with MaxInFlight hangs on shuffled Seq")
+	}
+	if len(results) != 2 || results[0].Seq != 1 || results[1].Seq != 0 {
+		t.Errorf("results not match\nGot: %v\nExpected: seq 1, 0", results)
+	}
+}
+
+func TestSignerPipeline(t *testing.T) {
+	testExpected := "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+	in := make(chan int, len(inputData))
+	for _, fibNum := range inputData {
+		in <- fibNum
+	}
+	close(in)
+	out := make(chan string, 1)
+
+	// int -> string -> string -> string, a stage of a wrong type does not compile
+	chain := pipeline.Then(pipeline.Then(pipeline.NewPipeline(SingleHashStage[int](SignerOptions{})), MultiHashStage(SignerOptions{})), CombineResultsStage())
+
+	start := time.Now()
+	if err := chain.Run(context.Background(), in, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	end := time.Since(start)
+
+	if testResult := <-out; testResult != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", testResult, testExpected)
+	}
+	if end > 3*time.Second {
+		t.Errorf("execition too long\nGot: %s\nExpected: <%s", end, time.Second*3)
+	}
+}
+
+func TestSignerOptions(t *testing.T) {
+	// fast signers counting how many crc32 calls run at once
+	var running, maxRunning int32
+	origMd5, origCrc32 := DataSignerMd5, DataSignerCrc32
+	defer func() {
+		DataSignerMd5, DataSignerCrc32 = origMd5, origCrc32
+	}()
+	DataSignerMd5 = func(data string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte(data)))
+	}
+	DataSignerCrc32 = func(data string) string {
+		currRunning := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			prevMax := atomic.LoadInt32(&maxRunning)
+			if currRunning <= prevMax || atomic.CompareAndSwapInt32(&maxRunning, prevMax, currRunning) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data))), 10)
+	}
+
+	runSigner := func(opts SignerOptions) string {
+		in := make(chan int)
+		go func() {
+			for num := 0; num < 300; num++ {
+				in <- num
+			}
+			close(in)
+		}()
+		out := make(chan string, 1)
+		if err := NewSignerPipeline[int](opts).Run(context.Background(), in, out); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return <-out
+	}
+
+	testExpected := runSigner(SignerOptions{})
+	opts := SignerOptions{
+		SingleHash: StageOptions{Workers: 4, BufferSize: 1},
+		MultiHash:  StageOptions{MaxInFlight: 2},
+		ThWorkers:  3,
+	}
+	atomic.StoreInt32(&maxRunning, 0)
+	if testResult := runSigner(opts); testResult != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", testResult, testExpected)
+	}
+	// 2 crc32 at once in a SingleHash worker, ThWorkers in a MultiHash item
+	if limit := int32(4*2 + 2*3); maxRunning > limit {
+		t.Errorf("too many crc32 calls at once\nGot: %d\nExpected: <=%d", maxRunning, limit)
+	}
+
+	// ordered stages keep the order within the same limits
+	results := make([]Sequenced, 0)
+	orderedOpts := SignerOptions{
+		SingleHash: StageOptions{Workers: 3},
+		MultiHash:  StageOptions{Workers: 2, MaxInFlight: 4},
+	}
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for num := 0; num < 50; num++ {
+				out <- num
+			}
+		}),
+		NewSingleHashOrdered(orderedOpts),
+		NewMultiHashOrdered(orderedOpts),
+		job(func(in, out chan interface{}) {
+			for dataRaw := range in {
+				results = append(results, dataRaw.(Sequenced))
+			}
+		}),
+	)
+	for resultIdx, result := range results {
+		if result.Seq != resultIdx {
+			t.Errorf("results not match\nGot: %v\nExpected: seq %d", result.Seq, resultIdx)
+		}
+	}
+	if len(results) != 50 {
+		t.Errorf("results not match\nGot: %d results\nExpected: 50 results", len(results))
+	}
+}
+
+func TestSignerLegacyBounded(t *testing.T) {
+	// slow crc32 counting how many calls run at once
+	var running, maxRunning int32
+	origMd5, origCrc32 := DataSignerMd5, DataSignerCrc32
+	defer func() {
+		DataSignerMd5, DataSignerCrc32 = origMd5, origCrc32
+	}()
+	DataSignerMd5 = func(data string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte(data)))
+	}
+	DataSignerCrc32 = func(data string) string {
+		currRunning := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			prevMax := atomic.LoadInt32(&maxRunning)
+			if currRunning <= prevMax || atomic.CompareAndSwapInt32(&maxRunning, prevMax, currRunning) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data))), 10)
+	}
+
+	runJob := func(hashJob job) int {
+		atomic.StoreInt32(&maxRunning, 0)
+		results := 0
+		ExecutePipeline(
+			job(func(in, out chan interface{}) {
+				for num := 0; num < 3*DefaultWorkers; num++ {
+					out <- num
+				}
+			}),
+			hashJob,
+			job(func(in, out chan interface{}) {
+				for range in {
+					results++
+				}
+			}),
+		)
+		if results != 3*DefaultWorkers {
+			t.Errorf("results not match\nGot: %d results\nExpected: %d results", results, 3*DefaultWorkers)
+		}
+		return int(atomic.LoadInt32(&maxRunning))
+	}
+
+	// 2 crc32 at once in a SingleHash worker, ThLimit in a MultiHash one
+	if got, limit := runJob(SingleHash), DefaultWorkers*2; got > limit {
+		t.Errorf("too many crc32 calls at once\nGot: %d\nExpected: <=%d", got, limit)
+	}
+	if got, limit := runJob(MultiHash), DefaultWorkers*ThLimit; got > limit {
+		t.Errorf("too many crc32 calls at once\nGot: %d\nExpected: <=%d", got, limit)
+	}
+	opts := SignerOptions{MultiHash: StageOptions{Workers: 2}, ThWorkers: 3}
+	if got, limit := runJob(NewMultiHash(opts)), 2*3; got > limit {
+		t.Errorf("too many crc32 calls at once\nGot: %d\nExpected: <=%d", got, limit)
+	}
+}
+
+func TestPipelineBuffered(t *testing.T) {
+	caps := make([]int, 3)
+	ctxJobs := make([]ctxJob, len(caps))
+	for jobIdx := range ctxJobs {
+		jobIdx := jobIdx
+		ctxJobs[jobIdx] = func(ctx context.Context, in, out chan interface{}) error {
+			caps[jobIdx] = cap(out)
+			for range in {
+			}
+			return nil
+		}
+	}
+
+	if err := ExecutePipelineBuffered(context.Background(), []int{1, 0}, ctxJobs...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1, pipeBufferSize, pipeBufferSize}; !reflect.DeepEqual(caps, expected) {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", caps, expected)
+	}
+}
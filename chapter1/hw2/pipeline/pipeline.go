@@ -0,0 +1,156 @@
+// Package pipeline chains typed stages with channels, a stage that does not read what the
+// previous one writes does not compile
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultBufferSize is the capacity of the pipes between stages unless set by WithBuffer
+const DefaultBufferSize = 100
+
+func bufferSize(size int) int {
+	if size > 0 {
+		return size
+	}
+	return DefaultBufferSize
+}
+
+func acquire(quotaCh chan struct{}) {
+	if quotaCh != nil {
+		quotaCh <- struct{}{}
+	}
+}
+
+func release(quotaCh chan struct{}) {
+	if quotaCh != nil {
+		<-quotaCh
+	}
+}
+
+// sequenced is an item with the index it was read at
+type sequenced[T any] struct {
+	seq  int
+	item T
+}
+
+// ForEach calls handle for every item of in, on a pool of workers or, if workers is 0, a goroutine per item.
+// An item takes a place in inFlightCh before it is read, handle or the caller frees it, nil is no limit.
+// Places have to be freed in read order or sooner, an item freed only after a later
+// read one would wait for a place forever
+func ForEach[In any](in chan In, workers int, inFlightCh chan struct{}, handle func(seq int, item In)) {
+	var wg sync.WaitGroup
+	itemsCh := make(chan sequenced[In])
+	for workerIdx := 0; workerIdx < workers; workerIdx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seqItem := range itemsCh {
+				handle(seqItem.seq, seqItem.item)
+			}
+		}()
+	}
+
+	seq := 0
+	for {
+		acquire(inFlightCh)
+		item, ok := <-in
+		if !ok {
+			release(inFlightCh)
+			break
+		}
+
+		if workers > 0 {
+			itemsCh <- sequenced[In]{seq, item}
+		} else {
+			wg.Add(1)
+			go func(seq int, item In) {
+				defer wg.Done()
+				handle(seq, item)
+			}(seq, item)
+		}
+		seq++
+	}
+	close(itemsCh)
+	wg.Wait()
+}
+
+// Stage is a typed job, it reads in until it is closed and the pipeline closes out after it returns
+type Stage[In, Out any] func(ctx context.Context, in chan In, out chan Out) error
+
+// stageGroup waits for the stages of one run and keeps the first error
+type stageGroup struct {
+	wg       sync.WaitGroup
+	errOnce  sync.Once
+	firstErr error
+	cancel   context.CancelFunc
+}
+
+func (group *stageGroup) fail(err error) {
+	group.errOnce.Do(func() {
+		group.firstErr = err
+	})
+	group.cancel()
+}
+
+// launchStage runs stage, then closes its out and drains its in
+func launchStage[In, Out any](ctx context.Context, group *stageGroup, stage Stage[In, Out], in chan In, out chan Out) {
+	group.wg.Add(1)
+	go func() {
+		defer group.wg.Done()
+		err := stage(ctx, in, out)
+		close(out)
+		if err != nil {
+			group.fail(err)
+		}
+		// a stage that stopped early must not leave the previous one blocked on send
+		for range in {
+		}
+	}()
+}
+
+// Pipeline turns In values into Out values, it is built with NewPipeline and Then
+type Pipeline[In, Out any] struct {
+	launch     func(ctx context.Context, group *stageGroup, in chan In, out chan Out)
+	bufferSize int // of the pipe Then adds after the last stage
+}
+
+// WithBuffer sets the capacity of the pipe the last stage writes to, if another stage is added
+func (pipeline Pipeline[In, Out]) WithBuffer(size int) Pipeline[In, Out] {
+	pipeline.bufferSize = size
+	return pipeline
+}
+
+// NewPipeline ...
+func NewPipeline[In, Out any](stage Stage[In, Out]) Pipeline[In, Out] {
+	return Pipeline[In, Out]{
+		launch: func(ctx context.Context, group *stageGroup, in chan In, out chan Out) {
+			launchStage(ctx, group, stage, in, out)
+		},
+	}
+}
+
+// Then appends a stage, it does not compile unless the stage reads what the pipeline writes
+func Then[In, Mid, Out any](pipeline Pipeline[In, Mid], stage Stage[Mid, Out]) Pipeline[In, Out] {
+	return Pipeline[In, Out]{
+		launch: func(ctx context.Context, group *stageGroup, in chan In, out chan Out) {
+			pipe := make(chan Mid, bufferSize(pipeline.bufferSize))
+			pipeline.launch(ctx, group, in, pipe)
+			launchStage(ctx, group, stage, pipe, out)
+		},
+	}
+}
+
+// Run waits for all stages, the first error cancels the others and is returned.
+// The caller closes in, out is closed when the last stage returns
+func (pipeline Pipeline[In, Out]) Run(ctx context.Context, in chan In, out chan Out) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	group := &stageGroup{cancel: cancel}
+	pipeline.launch(ctx, group, in, out)
+	group.wg.Wait()
+
+	return group.firstErr
+}
@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestPipelineRun(t *testing.T) {
+	double := Stage[int, int](func(ctx context.Context, in chan int, out chan int) error {
+		for num := range in {
+			out <- num * 2
+		}
+		return nil
+	})
+	format := Stage[int, string](func(ctx context.Context, in chan int, out chan string) error {
+		for num := range in {
+			out <- strconv.Itoa(num)
+		}
+		return nil
+	})
+
+	in, out := make(chan int, 3), make(chan string, 3)
+	for _, num := range []int{1, 2, 3} {
+		in <- num
+	}
+	close(in)
+	if err := Then(NewPipeline(double).WithBuffer(1), format).Run(context.Background(), in, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := make([]string, 0)
+	for result := range out {
+		results = append(results, result)
+	}
+	if expected := []string{"2", "4", "6"}; !reflect.DeepEqual(results, expected) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", results, expected)
+	}
+}
+
+func TestPipelineError(t *testing.T) {
+	errStage := errors.New("stage failed")
+	failing := Stage[int, int](func(ctx context.Context, in chan int, out chan int) error {
+		return errStage
+	})
+	// would hang without the cancel
+	stuck := Stage[int, int](func(ctx context.Context, in chan int, out chan int) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	in, out := make(chan int), make(chan int)
+	close(in)
+	if err := Then(NewPipeline(failing), stuck).Run(context.Background(), in, out); err != errStage {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", err, errStage)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	for _, workers := range []int{0, 2} {
+		in := make(chan string, 3)
+		for _, item := range []string{"a", "b", "c"} {
+			in <- item
+		}
+		close(in)
+
+		var mu sync.Mutex
+		results := make([]string, 0)
+		inFlightCh := make(chan struct{}, 1)
+		ForEach(in, workers, inFlightCh, func(seq int, item string) {
+			defer release(inFlightCh)
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, strconv.Itoa(seq)+item)
+		})
+		sort.Strings(results)
+		if expected := []string{"0a", "1b", "2c"}; !reflect.DeepEqual(results, expected) {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", results, expected)
+		}
+	}
+}
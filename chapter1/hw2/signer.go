@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"sync"
+
+	"./pipeline"
 )
 
 const (
@@ -11,91 +14,233 @@ const (
 	ThLimit            = 6
 )
 
+// ctxJob is a job that stops when ctx is done and reports why it failed
+type ctxJob func(ctx context.Context, in, out chan interface{}) error
+
 // func ExecutePipeline ...
 func ExecutePipeline(jobs ...job) {
-	// make pipes
-	pipes := make([]chan interface{}, len(jobs)+1)
-	for pipeIdx := 0; pipeIdx < len(pipes); pipeIdx++ {
-		pipes[pipeIdx] = make(chan interface{}, 100)
+	ctxJobs := make([]ctxJob, len(jobs))
+	for currJobIdx, currJob := range jobs {
+		currJob := currJob
+		ctxJobs[currJobIdx] = func(ctx context.Context, in, out chan interface{}) error {
+			currJob(in, out)
+			return nil
+		}
 	}
 
-	// launch jobs
-	var wg sync.WaitGroup
-	for currJobIdx, currJob := range jobs {
-		wg.Add(1)
-		go func(currJobIdx int, currJob job) {
-			defer wg.Done()
-			currJob(pipes[currJobIdx], pipes[currJobIdx+1])
-			close(pipes[currJobIdx+1])
-		}(currJobIdx, currJob)
+	ExecutePipelineContext(context.Background(), ctxJobs...)
+}
+
+// func ExecutePipelineContext runs jobs like ExecutePipeline, the first error cancels all of them and is returned
+func ExecutePipelineContext(ctx context.Context, jobs ...ctxJob) error {
+	return ExecutePipelineBuffered(ctx, nil, jobs...)
+}
+
+// func ExecutePipelineBuffered is ExecutePipelineContext with the pipe after jobs[i] of bufferSizes[i],
+// missing and zero sizes are pipeBufferSize
+func ExecutePipelineBuffered(ctx context.Context, bufferSizes []int, jobs ...ctxJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	opts := make([]StageOptions, len(jobs))
+	for jobIdx := 0; jobIdx < len(jobs) && jobIdx < len(bufferSizes); jobIdx++ {
+		opts[jobIdx].BufferSize = bufferSizes[jobIdx]
+	}
+
+	chain := pipeline.NewPipeline(pipeline.Stage[interface{}, interface{}](jobs[0])).WithBuffer(opts[0].BufferSize)
+	for currJobIdx, currJob := range jobs[1:] {
+		chain = pipeline.Then(chain, pipeline.Stage[interface{}, interface{}](currJob)).WithBuffer(opts[currJobIdx+1].BufferSize)
+	}
+
+	in := make(chan interface{})
+	close(in)
+	out := make(chan interface{}, opts[len(jobs)-1].bufferSize())
+	go func() {
+		for range out {
+		}
+	}()
+
+	return chain.Run(ctx, in, out)
+}
+
+// func sendContext sends value unless ctx is done first
+func sendContext(ctx context.Context, out chan interface{}, value interface{}) error {
+	select {
+	case out <- value:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// func singleHash ...
+func singleHash(rawData interface{}, quotaCh chan struct{}) string {
+	leftSideCh := make(chan string, 1)
+	go func() {
+		leftSideCh <- DataSignerCrc32(fmt.Sprint(rawData))
+	}()
+
+	// limited resource
+	quotaCh <- struct{}{}
+	tmpMd5HashSum := DataSignerMd5(fmt.Sprint(rawData))
+	<-quotaCh
+	//
+	rightSideHashSum := DataSignerCrc32(tmpMd5HashSum)
+
+	return <-leftSideCh + "~" + rightSideHashSum
+}
+
+// func hashJob hashes items like hashStage does, for the untyped jobs of ExecutePipeline
+func hashJob(in, out chan interface{}, opts StageOptions, hash func(rawData interface{}) string) {
+	inFlightCh := opts.inFlightQuota()
+	pipeline.ForEach(in, opts.workers(), inFlightCh, func(seq int, rawData interface{}) {
+		defer release(inFlightCh)
+		out <- hash(rawData)
+	})
+}
+
+// func NewSingleHash is SingleHash with stage options
+func NewSingleHash(opts SignerOptions) job {
+	return func(in, out chan interface{}) {
+		quotaCh := make(chan struct{}, opts.md5Limit())
+		hashJob(in, out, opts.SingleHash, func(rawData interface{}) string {
+			return singleHash(rawData, quotaCh)
+		})
 	}
-	wg.Wait()
 }
 
 // func SingleHash ...
 func SingleHash(in, out chan interface{}) {
-	var outerWG sync.WaitGroup
-	quotaCh := make(chan struct{}, MD5CalculatorLimit)
+	NewSingleHash(SignerOptions{})(in, out)
+}
 
-	for rawData := range in {
-		outerWG.Add(1)
-		go func(rawData interface{}) {
-			defer outerWG.Done()
-
-			waitCh := make(chan struct{}, 1)
-			leftSideHashSum := ""
-			go func() {
-				waitCh <- struct{}{}
-				leftSideHashSum = DataSignerCrc32(fmt.Sprint(rawData))
-				<-waitCh
-			}()
-
-			// limited resource
+// func multiHash ...
+func multiHash(rawData interface{}, thWorkers int) string {
+	results := make([]string, ThLimit)
+	var innerWG sync.WaitGroup
+	quotaCh := make(chan struct{}, thWorkers)
+
+	for th := 0; th < ThLimit; th++ {
+		innerWG.Add(1)
+		go func(th int) {
+			defer innerWG.Done()
 			quotaCh <- struct{}{}
-			tmpMd5HashSum := DataSignerMd5(fmt.Sprint(rawData))
+			results[th] = DataSignerCrc32(fmt.Sprint(th) + fmt.Sprint(rawData))
 			<-quotaCh
-			//
-			rightSideHashSum := DataSignerCrc32(tmpMd5HashSum)
+		}(th)
+	}
+	innerWG.Wait()
 
-			waitCh <- struct{}{}
-			out <- leftSideHashSum + "~" + rightSideHashSum
-			<-waitCh
-		}(rawData)
+	resultsStr := ""
+	for _, result := range results {
+		resultsStr += result
+	}
+
+	return resultsStr
+}
+
+// func NewMultiHash is MultiHash with stage options
+func NewMultiHash(opts SignerOptions) job {
+	return func(in, out chan interface{}) {
+		hashJob(in, out, opts.MultiHash, func(rawData interface{}) string {
+			return multiHash(rawData, opts.thWorkers())
+		})
 	}
-	outerWG.Wait()
 }
 
 // func MultiHash ...
 func MultiHash(in, out chan interface{}) {
-	var outerWG sync.WaitGroup
+	NewMultiHash(SignerOptions{})(in, out)
+}
 
-	for rawData := range in {
-		outerWG.Add(1)
-		go func(rawData interface{}) {
-			defer outerWG.Done()
-
-			results := make([]string, ThLimit)
-			var innerWG sync.WaitGroup
-
-			for th := 0; th < ThLimit; th++ {
-				innerWG.Add(1)
-				go func(th int) {
-					defer innerWG.Done()
-					results[th] = DataSignerCrc32(fmt.Sprint(th) + fmt.Sprint(rawData))
-				}(th)
-			}
-			innerWG.Wait()
+// Sequenced is an item of the ordered mode, Seq is the index of the pipeline input it came from
+type Sequenced struct {
+	Seq  int
+	Data interface{}
+}
+
+// reorderBuffer holds results that came before the ones read ahead of them
+type reorderBuffer struct {
+	nextIdx int
+	pending map[int]Sequenced // by the index the item was read at
+}
+
+// func push emits item and everything pending after it, once all items read before it are emitted,
+// it returns the number of emitted items
+func (buffer *reorderBuffer) push(readIdx int, item Sequenced, out chan interface{}) int {
+	buffer.pending[readIdx] = item
+	emitted := 0
+	for {
+		nextItem, ok := buffer.pending[buffer.nextIdx]
+		if !ok {
+			return emitted
+		}
+		delete(buffer.pending, buffer.nextIdx)
+		buffer.nextIdx++
+		out <- nextItem
+		emitted++
+	}
+}
+
+// func orderedStage hashes items concurrently and emits them in the order they were read.
+// Raw items get Seq by arrival, Sequenced ones keep theirs but are not reordered by it,
+// so gaps or a shuffled Seq upstream can not hold items back.
+// opts.MaxInFlight bounds the reorder buffer too, an item leaves the flight once emitted
+func orderedStage(in, out chan interface{}, opts StageOptions, hash func(rawData interface{}) string) {
+	// results with the index they were read at
+	type readResult struct {
+		readIdx int
+		item    Sequenced
+	}
+	resultsCh := make(chan readResult)
+	inFlightCh := opts.inFlightQuota()
 
-			resultsStr := ""
-			for _, result := range results {
-				resultsStr += result
+	go func() {
+		pipeline.ForEach(in, opts.workers(), inFlightCh, func(readIdx int, rawData interface{}) {
+			item, ok := rawData.(Sequenced)
+			if !ok {
+				item = Sequenced{Seq: readIdx, Data: rawData}
 			}
+			resultsCh <- readResult{readIdx, Sequenced{Seq: item.Seq, Data: hash(item.Data)}}
+		})
+		close(resultsCh)
+	}()
+
+	buffer := &reorderBuffer{pending: make(map[int]Sequenced)}
+	for result := range resultsCh {
+		for emitted := buffer.push(result.readIdx, result.item, out); emitted > 0; emitted-- {
+			release(inFlightCh)
+		}
+	}
+}
+
+// func NewSingleHashOrdered is SingleHashOrdered with stage options, pipe buffers are set by ExecutePipelineBuffered
+func NewSingleHashOrdered(opts SignerOptions) job {
+	return func(in, out chan interface{}) {
+		quotaCh := make(chan struct{}, opts.md5Limit())
+		orderedStage(in, out, opts.SingleHash, func(rawData interface{}) string {
+			return singleHash(rawData, quotaCh)
+		})
+	}
+}
 
-			out <- resultsStr
-		}(rawData)
+// func NewMultiHashOrdered is MultiHashOrdered with stage options
+func NewMultiHashOrdered(opts SignerOptions) job {
+	return func(in, out chan interface{}) {
+		orderedStage(in, out, opts.MultiHash, func(rawData interface{}) string {
+			return multiHash(rawData, opts.thWorkers())
+		})
 	}
+}
+
+// func SingleHashOrdered is SingleHash emitting Sequenced results in input order
+func SingleHashOrdered(in, out chan interface{}) {
+	NewSingleHashOrdered(SignerOptions{})(in, out)
+}
 
-	outerWG.Wait()
+// func MultiHashOrdered is MultiHash emitting Sequenced results in input order
+func MultiHashOrdered(in, out chan interface{}) {
+	NewMultiHashOrdered(SignerOptions{})(in, out)
 }
 
 // func CombineResults ...
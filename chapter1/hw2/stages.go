@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"./pipeline"
+)
+
+const pipeBufferSize = pipeline.DefaultBufferSize
+
+// DefaultWorkers is the goroutines of a stage unless set by StageOptions.Workers
+const DefaultWorkers = 100
+
+// StageOptions bound the resources of a stage, zero values keep the defaults
+type StageOptions struct {
+	Workers     int // goroutines processing items, DefaultWorkers if 0
+	MaxInFlight int // items read but not written yet, 0 is unlimited
+	BufferSize  int // capacity of the pipe the stage writes to, 0 is pipeBufferSize
+}
+
+func (opts StageOptions) workers() int {
+	if opts.Workers > 0 {
+		return opts.Workers
+	}
+	return DefaultWorkers
+}
+
+func (opts StageOptions) bufferSize() int {
+	if opts.BufferSize > 0 {
+		return opts.BufferSize
+	}
+	return pipeBufferSize
+}
+
+// inFlightQuota is nil, which does not limit anything, unless MaxInFlight is set
+func (opts StageOptions) inFlightQuota() chan struct{} {
+	if opts.MaxInFlight > 0 {
+		return make(chan struct{}, opts.MaxInFlight)
+	}
+	return nil
+}
+
+// SignerOptions configure the SingleHash, MultiHash, CombineResults pipeline
+type SignerOptions struct {
+	SingleHash StageOptions
+	MultiHash  StageOptions
+	MD5Limit   int // DataSignerMd5 calls at once, MD5CalculatorLimit if 0
+	ThWorkers  int // DataSignerCrc32 calls at once for one MultiHash item, ThLimit if 0
+}
+
+func (opts SignerOptions) md5Limit() int {
+	if opts.MD5Limit > 0 {
+		return opts.MD5Limit
+	}
+	return MD5CalculatorLimit
+}
+
+func (opts SignerOptions) thWorkers() int {
+	if opts.ThWorkers > 0 {
+		return opts.ThWorkers
+	}
+	return ThLimit
+}
+
+func acquire(quotaCh chan struct{}) {
+	if quotaCh != nil {
+		quotaCh <- struct{}{}
+	}
+}
+
+func release(quotaCh chan struct{}) {
+	if quotaCh != nil {
+		<-quotaCh
+	}
+}
+
+// hashStage hashes items like SingleHash and MultiHash do, within opts
+func hashStage[In any](opts StageOptions, hash func(rawData interface{}) string) pipeline.Stage[In, string] {
+	return func(ctx context.Context, in chan In, out chan string) error {
+		inFlightCh := opts.inFlightQuota()
+		pipeline.ForEach(in, opts.workers(), inFlightCh, func(seq int, rawData In) {
+			defer release(inFlightCh)
+			// items read after a cancel are not worth hashing
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case out <- hash(rawData):
+			case <-ctx.Done():
+			}
+		})
+
+		return ctx.Err()
+	}
+}
+
+// SingleHashStage is SingleHash of any input type
+func SingleHashStage[In any](opts SignerOptions) pipeline.Stage[In, string] {
+	quotaCh := make(chan struct{}, opts.md5Limit())
+	return hashStage[In](opts.SingleHash, func(rawData interface{}) string {
+		return singleHash(rawData, quotaCh)
+	})
+}
+
+// MultiHashStage is MultiHash of SingleHashStage results
+func MultiHashStage(opts SignerOptions) pipeline.Stage[string, string] {
+	return hashStage[string](opts.MultiHash, func(rawData interface{}) string {
+		return multiHash(rawData, opts.thWorkers())
+	})
+}
+
+// CombineResultsStage is CombineResults of MultiHashStage results
+func CombineResultsStage() pipeline.Stage[string, string] {
+	return func(ctx context.Context, in chan string, out chan string) error {
+		results := make([]string, 0)
+		for hashSum := range in {
+			results = append(results, hashSum)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		sort.Strings(results)
+		select {
+		case out <- strings.Join(results, "_"):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// NewSignerPipeline chains SingleHashStage, MultiHashStage and CombineResultsStage
+func NewSignerPipeline[In any](opts SignerOptions) pipeline.Pipeline[In, string] {
+	singleHash := pipeline.NewPipeline(SingleHashStage[In](opts)).WithBuffer(opts.SingleHash.BufferSize)
+	multiHash := pipeline.Then(singleHash, MultiHashStage(opts)).WithBuffer(opts.MultiHash.BufferSize)
+	return pipeline.Then(multiHash, CombineResultsStage())
+}